@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// archivedSince reports whether p is archived at now and since when. A page
+// is archived when its front matter says so, when its expires date has
+// passed, or when it has gone archive_after_days without an edit. The zero
+// time means the page was archived explicitly.
+func (s *Server) archivedSince(p *Page, now time.Time) (time.Time, bool) {
+	if p.Meta.Archived {
+		return time.Time{}, true
+	}
+	if p.Meta.Expires != "" {
+		if expires, err := time.ParseInLocation(dateLayout, p.Meta.Expires, time.Local); err == nil && !now.Before(expires) {
+			return expires, true
+		}
+	}
+	if days, _ := strconv.Atoi(s.settings.Get("archive_after_days")); days > 0 && !p.ModTime.IsZero() {
+		if cutoff := p.ModTime.AddDate(0, 0, days); !now.Before(cutoff) {
+			return cutoff, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *Server) markArchived(p *Page, now time.Time) {
+	since, archived := s.archivedSince(p, now)
+	p.Archived = archived
+	if !since.IsZero() {
+		p.ArchivedSince = since.Format(dateLayout)
+	}
+}
+
+func validateExpires(ctx context.Context, p *Page) error {
+	meta, _, err := parseFrontMatter(p.Body)
+	if err != nil || meta.Expires == "" {
+		return nil
+	}
+	if _, err := time.Parse(dateLayout, meta.Expires); err != nil {
+		return fmt.Errorf("expires must be a date like 2024-12-31, not %q", meta.Expires)
+	}
+	return nil
+}
+
+func withoutArchived(pages []*Page) []*Page {
+	var live []*Page
+	for _, p := range pages {
+		if !p.Archived {
+			live = append(live, p)
+		}
+	}
+	return live
+}
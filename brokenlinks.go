@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+type brokenLink struct {
+	Target  string
+	Sources []string
+}
+
+// brokenLinks lists wiki link targets that have no page, with the pages
+// linking to each. Redirect stubs count as existing pages.
+func (s *Server) brokenLinks(ctx context.Context) ([]brokenLink, error) {
+	pages, err := s.loadAllPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, p := range pages {
+		exists[p.Title] = true
+	}
+
+	sources := map[string][]string{}
+	for _, p := range pages {
+		_, content, err := parseFrontMatter(p.Body)
+		if err != nil {
+			content = p.Body
+		}
+		for target := range pageLinks(content) {
+			if !exists[target] {
+				sources[target] = append(sources[target], p.Title)
+			}
+		}
+	}
+
+	var broken []brokenLink
+	for target, from := range sources {
+		sort.Strings(from)
+		broken = append(broken, brokenLink{Target: target, Sources: from})
+	}
+	sort.Slice(broken, func(i, j int) bool { return broken[i].Target < broken[j].Target })
+	return broken, nil
+}
+
+func (s *Server) brokenLinksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	broken, err := s.brokenLinks(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderTemplate(w, "brokenlinks", broken)
+}
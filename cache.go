@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cacheablePrefixes are the read-only routes whose responses are the same
+// for every visitor, and so may be kept by shared caches.
+var cacheablePrefixes = []string{"/view/", "/all", "/journal", "/tasks", "/api/tasks", "/api/preview/", "/api/related/", "/robots.txt", "/opensearch.xml"}
+
+// cacheControl returns the Cache-Control value for a request, before the
+// handler has had a say. Anything that changes state or shows an editor
+// is never stored.
+func (s *Server) cacheControl(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "no-store"
+	}
+	for _, prefix := range cacheablePrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			if s.config.CachePageSeconds <= 0 && s.config.CacheBrowserSeconds <= 0 {
+				return "no-cache"
+			}
+			return "public, max-age=" + strconv.Itoa(s.config.CacheBrowserSeconds) +
+				", s-maxage=" + strconv.Itoa(s.config.CachePageSeconds)
+		}
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/quickswitch") || strings.HasPrefix(r.URL.Path, "/api/suggest") {
+		return "private, no-cache"
+	}
+	return "no-store"
+}
+
+type cacheWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader keeps shared caches from storing a response that sets a
+// cookie, such as the first page view of a new visitor.
+func (cw *cacheWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		h := cw.Header()
+		if h.Get("Set-Cookie") != "" && strings.HasPrefix(h.Get("Cache-Control"), "public") {
+			h.Set("Cache-Control", "private, no-cache")
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (s *Server) cacheHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", s.cacheControl(r))
+		next.ServeHTTP(&cacheWriter{ResponseWriter: w}, r)
+	})
+}
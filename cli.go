@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve [flags]", serveCommand},
+	{"new", "new [flags] Title < body.txt", newCommand},
+	{"import", "import [flags] DIR", importCommand},
+	{"export", "export [flags] DIR", exportCommand},
+	{"encrypt", "encrypt -encryption-key-file FILE [flags]", encryptCommand},
+	{"tui", "tui [flags]", tuiCommand},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wiki <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  wiki "+c.usage)
+	}
+}
+
+// run dispatches to a subcommand. With no command, or when the first
+// argument is a flag, it serves, so existing `./wiki -addr ...` setups keep
+// working.
+func run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serveCommand(args)
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	usage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func storageFlags(fs *flag.FlagSet, config *Config) {
+	fs.StringVar(&config.Store, "store", "file", "page storage backend: file or memory")
+	fs.StringVar(&config.DataDir, "data", "data", "directory holding page files")
+	fs.BoolVar(&config.Fsync, "fsync", false, "fsync page files after every save")
+	fs.StringVar(&config.EncryptionKeyFile, "encryption-key-file", "", "file holding a 256-bit key to encrypt page bodies with")
+}
+
+func openBackend(config Config) (PageStore, error) {
+	switch config.Store {
+	case "file":
+		return newFileStore(config.DataDir, config.Fsync), nil
+	case "memory":
+		return newMemStore(), nil
+	}
+	return nil, fmt.Errorf("unknown store %q", config.Store)
+}
+
+func openEncrypted(config Config) (*encryptedStore, error) {
+	store, err := openBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	key, err := readKeyFile(config.EncryptionKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptedStore(store, key)
+}
+
+// openStore opens the configured store. With an encryption key, a data
+// directory still holding plaintext pages is refused: those pages could
+// not be read, so the wiki would be broken until `wiki encrypt` is run.
+func openStore(config Config) (PageStore, error) {
+	if config.EncryptionKeyFile == "" {
+		return openBackend(config)
+	}
+	store, err := openEncrypted(config)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := store.plaintextPages(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) > 0 {
+		return nil, fmt.Errorf("%d pages, such as %s, are not encrypted; run wiki encrypt with the same -data and -encryption-key-file first", len(plain), plain[0])
+	}
+	return store, nil
+}
+
+// openServer sets up a server for commands that change pages without
+// serving, so their saves go through the same validators and events.
+func openServer(config Config) (*Server, error) {
+	store, err := openStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(config, store)
+}
+
+func serveCommand(args []string) error {
+	var config Config
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	storageFlags(fs, &config)
+	fs.StringVar(&config.Addr, "addr", ":8080", "address to listen on")
+	fs.StringVar(&config.TemplateDir, "templates", "tmpl", "directory of HTML templates overriding the built-in ones")
+	fs.DurationVar(&config.StoreTimeout, "store-timeout", 10*time.Second, "maximum time a request may spend on storage calls")
+	fs.Int64Var(&config.MaxPageBytes, "max-page-bytes", 1<<20, "largest page body that can be saved, 0 for no limit")
+	fs.Int64Var(&config.MaxRequestBytes, "max-request-bytes", 4<<20, "largest request body accepted, 0 for no limit")
+	fs.DurationVar(&config.ReadHeaderTimeout, "read-header-timeout", 5*time.Second, "maximum time to read request headers")
+	fs.DurationVar(&config.ReadTimeout, "read-timeout", 30*time.Second, "maximum time to read a whole request")
+	fs.DurationVar(&config.WriteTimeout, "write-timeout", 30*time.Second, "maximum time to write a response")
+	fs.DurationVar(&config.IdleTimeout, "idle-timeout", 2*time.Minute, "how long idle keep-alive connections stay open")
+	fs.IntVar(&config.MaxHeaderBytes, "max-header-bytes", 64<<10, "largest request header block accepted")
+	reviewEvery := fs.Duration("review-check-interval", time.Hour, "how often to look for pages overdue for review")
+	fs.StringVar(&config.ContentSecurityPolicy, "csp", defaultCSP, "Content-Security-Policy for HTML pages, empty to omit")
+	fs.StringVar(&config.FrameAncestors, "frame-ancestors", "'none'", "CSP frame-ancestors sources allowed to embed the wiki, empty to omit")
+	fs.StringVar(&config.ExternalLinks.Rel, "external-link-rel", "nofollow noopener", "rel attribute for links to other sites")
+	fs.StringVar(&config.ExternalLinks.Target, "external-link-target", "", "target attribute for links to other sites, e.g. _blank")
+	fs.StringVar(&config.ExternalLinks.Class, "external-link-class", "external", "CSS class marking links to other sites")
+	fs.BoolVar(&config.ExternalLinks.Interstitial, "external-link-interstitial", false, "route links to other sites through a /leave confirmation page")
+	fs.StringVar(&config.InboundEmailToken, "inbound-email-token", "", "secret enabling the /api/email/TOKEN mail gateway, empty to disable")
+	fs.StringVar(&config.InboundEmailAddress, "inbound-email-address", "", "address inbound mail must be sent to, empty to accept any")
+	fs.StringVar(&config.InboundHooksFile, "inbound-hooks", "", "JSON file listing /api/inbound/TOKEN webhooks that append to pages")
+	fs.StringVar(&config.BaseURL, "base-url", "", "public URL of the wiki, e.g. https://wiki.example.com")
+	fs.BoolVar(&config.Webmention, "webmention", false, "send and accept webmentions (needs -base-url)")
+	fs.StringVar(&config.RobotsFile, "robots", "", "file served as /robots.txt instead of the generated one")
+	fs.BoolVar(&config.NoIndex, "noindex", false, "ask search engines not to index any page")
+	fs.BoolVar(&config.RedactSecrets, "redact-secrets", true, "mask likely passwords, tokens and keys when showing pages")
+	fs.StringVar(&config.SecretPatternsFile, "secret-patterns", "", "file of extra regular expressions, one per line, that match secrets")
+	fs.IntVar(&config.CachePageSeconds, "cache-page-seconds", 0, "how long shared caches such as a CDN may keep page views (s-maxage)")
+	fs.IntVar(&config.CacheBrowserSeconds, "cache-browser-seconds", 0, "how long browsers may keep page views without revalidating (max-age)")
+	dictionaries := fs.String("dictionaries", "", "comma-separated word lists for /api/spellcheck, e.g. /usr/share/dict/words")
+	fs.BoolVar(&config.LintStrict, "lint-strict", false, "refuse to save pages with lint warnings")
+	fs.StringVar(&config.ShortcodesFile, "shortcodes", "", "JSON file of custom shortcodes, mapping names to HTML templates")
+	embedHosts := fs.String("embed-hosts", "", "comma-separated sites whose links may become oEmbed embeds, e.g. youtube.com,vimeo.com")
+	fs.StringVar(&config.ReferrerPolicy, "referrer-policy", "strict-origin-when-cross-origin", "Referrer-Policy for HTML pages, empty to omit")
+	corsOrigins := fs.String("cors-origins", "", "comma-separated origins whose pages may call /api, e.g. https://app.example.com, or * for any")
+	fs.Parse(args)
+	for _, origin := range strings.Split(*corsOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.CORSOrigins = append(config.CORSOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	for _, path := range strings.Split(*dictionaries, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			config.DictionaryFiles = append(config.DictionaryFiles, path)
+		}
+	}
+	for _, host := range strings.Split(*embedHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			config.EmbedHosts = append(config.EmbedHosts, host)
+		}
+	}
+
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+	s, err := NewServer(config, store)
+	if err != nil {
+		return err
+	}
+	go s.RunReviewJob(context.Background(), *reviewEvery)
+	fmt.Println("Starting server on " + config.Addr)
+	return s.HTTPServer().ListenAndServe()
+}
+
+func newCommand(args []string) error {
+	var config Config
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	storageFlags(fs, &config)
+	force := fs.Bool("f", false, "overwrite the page if it already exists")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: wiki new [flags] Title < body.txt")
+	}
+	title := canonical(fs.Arg(0))
+	if !validTitle.MatchString(title) {
+		return fmt.Errorf("invalid page title %q", title)
+	}
+
+	s, err := openServer(config)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if !*force {
+		_, err := s.store.Load(ctx, title)
+		if err == nil {
+			return fmt.Errorf("page %s already exists (use -f to overwrite)", title)
+		}
+		if !errors.Is(err, errPageNotFound) {
+			return err
+		}
+	}
+	body, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	return s.savePage(ctx, &Page{Title: title, Body: norm.NFC.Bytes(body)})
+}
+
+func importCommand(args []string) error {
+	var config Config
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	storageFlags(fs, &config)
+	overwrite := fs.Bool("overwrite", false, "replace pages that already exist")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: wiki import [flags] DIR")
+	}
+	dir := fs.Arg(0)
+
+	s, err := openServer(config)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".txt" {
+			continue
+		}
+		title := canonical(strings.TrimSuffix(entry.Name(), ".txt"))
+		if !validTitle.MatchString(title) {
+			fmt.Fprintf(os.Stderr, "skipping %s: invalid page title\n", entry.Name())
+			continue
+		}
+		if !*overwrite {
+			_, err := s.store.Load(ctx, title)
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "skipping %s: page already exists\n", title)
+				continue
+			}
+			if !errors.Is(err, errPageNotFound) {
+				return err
+			}
+		}
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		p := &Page{Title: title, Body: norm.NFC.Bytes(body)}
+		if err := s.validatePage(ctx, p); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", title, err)
+			continue
+		}
+		if err := s.savePage(ctx, p); err != nil {
+			return err
+		}
+		fmt.Println("imported " + title)
+	}
+	return nil
+}
+
+// encryptCommand encrypts the plaintext pages of a data directory, so it
+// can be served with -encryption-key-file. Pages already encrypted with
+// the key are left alone.
+func encryptCommand(args []string) error {
+	var config Config
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	storageFlags(fs, &config)
+	fs.Parse(args)
+	if config.EncryptionKeyFile == "" || fs.NArg() != 0 {
+		return errors.New("usage: wiki encrypt -encryption-key-file FILE [flags]")
+	}
+
+	store, err := openEncrypted(config)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	plain, err := store.plaintextPages(ctx)
+	if err != nil {
+		return err
+	}
+	if err := store.encryptPlaintext(ctx, plain); err != nil {
+		return err
+	}
+	fmt.Printf("encrypted %d pages\n", len(plain))
+	return nil
+}
+
+func exportCommand(args []string) error {
+	var config Config
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	storageFlags(fs, &config)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: wiki export [flags] DIR")
+	}
+	dir := fs.Arg(0)
+
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	titles, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, title := range titles {
+		p, err := store.Load(ctx, title)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, title+".txt"), p.Body, 0600); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("exported %d pages to %s\n", len(titles), dir)
+	return nil
+}
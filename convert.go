@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlConverter turns pasted HTML into wiki source. Block elements end the
+// current line, since every line is a paragraph on the wiki; inline
+// formatting is dropped and only text and links survive.
+type htmlConverter struct {
+	baseURL string
+	lines   []string
+	line    strings.Builder
+}
+
+// blockElements start a new line of wiki text.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Blockquote: true, atom.Section: true, atom.Article: true, atom.Hr: true,
+	atom.Dt: true, atom.Dd: true,
+}
+
+// skippedElements never contribute text.
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Iframe: true, atom.Object: true,
+}
+
+// convertHTML returns wiki source for an HTML document or fragment. Links
+// into the wiki, relative or under baseURL, become [[Title]] links.
+func convertHTML(r io.Reader, baseURL string) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	c := &htmlConverter{baseURL: strings.TrimSuffix(baseURL, "/")}
+	c.node(doc)
+	c.endLine()
+	return strings.Join(c.lines, "\n"), nil
+}
+
+func (c *htmlConverter) endLine() {
+	if text := strings.TrimSpace(c.line.String()); text != "" {
+		c.lines = append(c.lines, text)
+	}
+	c.line.Reset()
+}
+
+// text appends running text with HTML whitespace collapsed.
+func (c *htmlConverter) text(s string) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" && c.line.Len() > 0 {
+			c.line.WriteByte(' ')
+		}
+		return
+	}
+	if startsWithSpace(s) && c.line.Len() > 0 {
+		c.line.WriteByte(' ')
+	}
+	c.line.WriteString(strings.Join(words, " "))
+	if endsWithSpace(s) {
+		c.line.WriteByte(' ')
+	}
+}
+
+func startsWithSpace(s string) bool { return strings.TrimLeft(s, " \t\r\n") != s }
+func endsWithSpace(s string) bool   { return strings.TrimRight(s, " \t\r\n") != s }
+
+func (c *htmlConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+	switch {
+	case skippedElements[n.DataAtom]:
+		return
+	case n.DataAtom == atom.A:
+		c.link(n)
+		return
+	case n.DataAtom == atom.Pre:
+		c.endLine()
+		c.pre(n)
+		return
+	case n.DataAtom == atom.Table:
+		c.endLine()
+		c.table(n)
+		return
+	case n.DataAtom == atom.Li:
+		c.endLine()
+		c.line.WriteString("- ")
+		c.children(n)
+		c.endLine()
+		return
+	case blockElements[n.DataAtom]:
+		c.endLine()
+		c.children(n)
+		c.endLine()
+		return
+	}
+	c.children(n)
+}
+
+func (c *htmlConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.node(child)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textContent is the whitespace-collapsed text inside n.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && skippedElements[n.DataAtom] {
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// wikiTitle returns the page an href points at when it is a view link of
+// this wiki.
+func (c *htmlConverter) wikiTitle(href string) (string, bool) {
+	if c.baseURL != "" {
+		href = strings.TrimPrefix(href, c.baseURL)
+	}
+	rest, ok := strings.CutPrefix(href, "/view/")
+	if !ok {
+		return "", false
+	}
+	title, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", false
+	}
+	title = canonical(title)
+	return title, validTitle.MatchString(title)
+}
+
+func (c *htmlConverter) link(n *html.Node) {
+	href := attr(n, "href")
+	text := textContent(n)
+	if c.line.Len() > 0 && !endsWithSpace(c.line.String()) {
+		if prev := n.PrevSibling; prev != nil && prev.Type == html.TextNode && endsWithSpace(prev.Data) {
+			c.line.WriteByte(' ')
+		}
+	}
+	if title, ok := c.wikiTitle(href); ok {
+		c.line.WriteString("[[" + title + "]]")
+		return
+	}
+	if u, ok := httpURL(href); ok && text != "" && !strings.ContainsAny(href, " ]") {
+		c.line.WriteString("[" + u.String() + " " + strings.ReplaceAll(text, "]", ")") + "]")
+		return
+	}
+	c.line.WriteString(text)
+}
+
+// pre keeps preformatted text as a fenced block. A data-lang attribute,
+// as the rich-text editor writes, restores the block's language line.
+func (c *htmlConverter) pre(n *html.Node) {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Br {
+			b.WriteByte('\n')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	header := strings.TrimSpace(attr(n, "data-lang") + " " + attr(n, "data-args"))
+	content := strings.Trim(b.String(), "\n")
+	if content == "" && header != "" {
+		c.lines = append(c.lines, fence+header+fence)
+		return
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		// A line holding only a fence would end the block early.
+		if strings.TrimSpace(line) == fence {
+			lines[i] = "'''"
+		}
+	}
+	c.lines = append(c.lines, fence+header)
+	c.lines = append(c.lines, lines...)
+	c.lines = append(c.lines, fence)
+}
+
+// table becomes a csv block, which the wiki renders back as a table.
+func (c *htmlConverter) table(n *html.Node) {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Tr {
+			var row []string
+			for cell := n.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					row = append(row, textContent(cell))
+				}
+			}
+			if len(row) > 0 {
+				rows = append(rows, row)
+			}
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.WriteAll(rows)
+	c.lines = append(c.lines, fence+"csv", strings.TrimSuffix(b.String(), "\n"), fence)
+}
+
+// apiConvertHandler converts a POSTed HTML body, such as a rich-text
+// paste, to wiki source.
+func (s *Server) apiConvertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST the HTML to convert"})
+		return
+	}
+	source, err := convertHTML(r.Body, s.baseURL(r))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"source": canonical(source)})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+type copyForm struct {
+	Title     string
+	NewTitle  string
+	StripMeta bool
+	Error     string
+}
+
+func (s *Server) copyHandler(w http.ResponseWriter, r *http.Request, title string) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	src, err := s.store.Load(ctx, title)
+	if errors.Is(err, errPageNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	form := copyForm{Title: title, NewTitle: title + "Copy"}
+	if r.Method != http.MethodPost {
+		s.renderTemplate(w, "copy", form)
+		return
+	}
+
+	if !parseForm(w, r) {
+		return
+	}
+	form.NewTitle = canonical(r.FormValue("title"))
+	form.StripMeta = r.FormValue("strip_meta") != ""
+
+	body := src.Body
+	if form.StripMeta {
+		if _, content, err := parseFrontMatter(body); err == nil {
+			body = content
+		}
+	}
+	p := &Page{Title: form.NewTitle, Body: body}
+	unlock := s.locks.Lock(form.NewTitle)
+	defer unlock()
+
+	if !validTitle.MatchString(form.NewTitle) {
+		form.Error = "Titles may only contain letters and digits."
+	} else if _, err := s.store.Load(ctx, form.NewTitle); err == nil {
+		form.Error = form.NewTitle + " already exists."
+	} else if !errors.Is(err, errPageNotFound) {
+		storeError(w, err)
+		return
+	} else if err := s.validatePage(ctx, p); err != nil {
+		form.Error = err.Error()
+	}
+	if form.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		s.renderTemplate(w, "copy", form)
+		return
+	}
+
+	if err := s.store.Save(ctx, p); err != nil {
+		storeError(w, err)
+		return
+	}
+	s.events.Publish(Event{Kind: EventPageSaved, Title: p.Title})
+	http.Redirect(w, r, "/edit/"+p.Title, http.StatusFound)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// encryptedMagic starts every body written by encryptedStore, so a stray
+// plaintext file is reported instead of being fed to the cipher.
+var encryptedMagic = []byte("wikienc1")
+
+// encryptedStore seals page bodies with AES-256-GCM before they reach the
+// wrapped store. The title is authenticated as additional data, so a
+// body copied onto another page fails to open. Titles themselves, and
+// modification times, are still visible to the backend.
+type encryptedStore struct {
+	inner PageStore
+	aead  cipher.AEAD
+}
+
+func newEncryptedStore(inner PageStore, key []byte) (*encryptedStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedStore{inner: inner, aead: aead}, nil
+}
+
+// readKeyFile reads a 256-bit key stored raw, as hex or as base64.
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	text := string(bytes.TrimSpace(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: want a 32-byte key, raw, hex or base64", path)
+}
+
+func (s *encryptedStore) Load(ctx context.Context, title string) (*Page, error) {
+	p, err := s.inner.Load(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	sealed, ok := bytes.CutPrefix(p.Body, encryptedMagic)
+	n := s.aead.NonceSize()
+	if !ok || len(sealed) < n {
+		return nil, fmt.Errorf("%s: page is not encrypted", title)
+	}
+	p.Body, err = s.aead.Open(nil, sealed[:n], sealed[n:], []byte(title))
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot decrypt page: %w", title, err)
+	}
+	return p, nil
+}
+
+func (s *encryptedStore) Save(ctx context.Context, p *Page) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	body := append(append([]byte{}, encryptedMagic...), nonce...)
+	body = s.aead.Seal(body, nonce, p.Body, []byte(p.Title))
+	return s.inner.Save(ctx, &Page{Title: p.Title, Body: body})
+}
+
+func (s *encryptedStore) List(ctx context.Context) ([]string, error) {
+	return s.inner.List(ctx)
+}
+
+// plaintextPages lists the pages of the wrapped store that were written
+// without encryption, as every page is when a key is first turned on.
+func (s *encryptedStore) plaintextPages(ctx context.Context) ([]string, error) {
+	titles, err := s.inner.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var plain []string
+	for _, title := range titles {
+		p, err := s.inner.Load(ctx, title)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(p.Body, encryptedMagic) {
+			plain = append(plain, title)
+		}
+	}
+	return plain, nil
+}
+
+// encryptPlaintext encrypts the pages plaintextPages finds in place.
+func (s *encryptedStore) encryptPlaintext(ctx context.Context, titles []string) error {
+	for _, title := range titles {
+		p, err := s.inner.Load(ctx, title)
+		if err != nil {
+			return err
+		}
+		if err := s.Save(ctx, &Page{Title: title, Body: p.Body}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	ctx := context.Background()
+	inner := newMemStore()
+	s, err := newEncryptedStore(inner, bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, &Page{Title: "Secret", Body: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := inner.Load(ctx, "Secret")
+	if bytes.Contains(raw.Body, []byte("hello")) || !bytes.HasPrefix(raw.Body, encryptedMagic) {
+		t.Errorf("stored body %q is not sealed", raw.Body)
+	}
+	p, err := s.Load(ctx, "Secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Body) != "hello" {
+		t.Errorf("Load = %q, want hello", p.Body)
+	}
+
+	// A sealed body moved onto another title must not open.
+	inner.Save(ctx, &Page{Title: "Other", Body: raw.Body})
+	if _, err := s.Load(ctx, "Other"); err == nil {
+		t.Error("a body copied to another title decrypted")
+	}
+
+	inner.Save(ctx, &Page{Title: "Plain", Body: []byte("text")})
+	if _, err := s.Load(ctx, "Plain"); err == nil {
+		t.Error("a plaintext page was read as-is")
+	}
+	plain, err := s.plaintextPages(ctx)
+	if err != nil || len(plain) != 1 || plain[0] != "Plain" {
+		t.Fatalf("plaintextPages = %v, %v", plain, err)
+	}
+	if err := s.encryptPlaintext(ctx, plain); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := s.Load(ctx, "Plain"); err != nil {
+		t.Errorf("after encryptPlaintext: %v", err)
+	} else if string(p.Body) != "text" {
+		t.Errorf("after encryptPlaintext, Load = %q, want text", p.Body)
+	}
+}
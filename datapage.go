@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"sort"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type fieldSpec struct {
+	Type     string `yaml:"type"`
+	Required bool   `yaml:"required"`
+}
+
+// dataSchema is the body of a schema page: the fields a data page must
+// provide, and optionally the title of a page holding the html/template
+// used to render it.
+type dataSchema struct {
+	Template string               `yaml:"template"`
+	Fields   map[string]fieldSpec `yaml:"fields"`
+}
+
+var defaultDataTemplate = template.Must(template.New("data").Parse(
+	`<dl>{{range $k, $v := .}}<dt>{{$k}}</dt><dd>{{$v}}</dd>{{end}}</dl>`))
+
+func (sc *dataSchema) validate(data map[string]any) error {
+	names := make([]string, 0, len(sc.Fields))
+	for name := range sc.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec := sc.Fields[name]
+		v, ok := data[name]
+		if !ok || v == nil {
+			if spec.Required {
+				return fmt.Errorf("field %q is required", name)
+			}
+			continue
+		}
+		if !fieldHasType(v, spec.Type) {
+			return fmt.Errorf("field %q must be a %s", name, spec.Type)
+		}
+	}
+	return nil
+}
+
+func fieldHasType(v any, typ string) bool {
+	switch typ {
+	case "", "any":
+		return true
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		switch v.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+		return false
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "list":
+		_, ok := v.([]any)
+		return ok
+	case "map":
+		_, ok := v.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+// loadSource loads a page and returns its body without front matter.
+func (s *Server) loadSource(ctx context.Context, title string) ([]byte, error) {
+	p, err := s.store.Load(ctx, title)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", title, err)
+	}
+	_, content, err := parseFrontMatter(p.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", title, err)
+	}
+	return content, nil
+}
+
+func (s *Server) loadSchema(ctx context.Context, title string) (*dataSchema, error) {
+	if !validTitle.MatchString(title) {
+		return nil, fmt.Errorf("invalid schema page title %q", title)
+	}
+	source, err := s.loadSource(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	var schema dataSchema
+	if err := yaml.Unmarshal(source, &schema); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", title, err)
+	}
+	return &schema, nil
+}
+
+// decodeData parses a data page body (YAML, or JSON as a subset of it)
+// and checks it against the page's schema.
+func (s *Server) decodeData(ctx context.Context, meta Metadata, content []byte) (map[string]any, *dataSchema, error) {
+	var data map[string]any
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		return nil, nil, fmt.Errorf("data: %w", err)
+	}
+	if meta.Schema == "" {
+		return data, &dataSchema{}, nil
+	}
+	schema, err := s.loadSchema(ctx, meta.Schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := schema.validate(data); err != nil {
+		return nil, nil, err
+	}
+	return data, schema, nil
+}
+
+func (s *Server) validateDataPage(ctx context.Context, p *Page) error {
+	meta, content, err := parseFrontMatter(p.Body)
+	if err != nil || meta.Type != "data" {
+		return nil
+	}
+	_, _, err = s.decodeData(ctx, meta, content)
+	return err
+}
+
+func (s *Server) renderDataPage(ctx context.Context, meta Metadata, content []byte) (template.HTML, error) {
+	data, schema, err := s.decodeData(ctx, meta, content)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl := defaultDataTemplate
+	if schema.Template != "" {
+		if !validTitle.MatchString(schema.Template) {
+			return "", fmt.Errorf("invalid template page title %q", schema.Template)
+		}
+		source, err := s.loadSource(ctx, schema.Template)
+		if err != nil {
+			return "", err
+		}
+		tmpl, err = template.New(schema.Template).Parse(string(source))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	embedCacheTTL     = 24 * time.Hour
+	embedFailureTTL   = 10 * time.Minute
+	embedCacheEntries = 1000
+)
+
+// embedder turns URLs on allowed hosts into embeds with oEmbed: the page
+// is fetched for its <link type="application/json+oembed"> and the
+// endpoint asked for the embed. Results, failures included, are cached
+// so a page view does not fetch the same URLs each time.
+type embedder struct {
+	hosts []string
+
+	mu    sync.Mutex
+	cache map[string]embedEntry
+}
+
+type embedEntry struct {
+	html    template.HTML
+	err     error
+	expires time.Time
+}
+
+func newEmbedder(hosts []string) *embedder {
+	e := &embedder{cache: map[string]embedEntry{}}
+	for _, h := range hosts {
+		e.hosts = append(e.hosts, strings.ToLower(strings.TrimPrefix(h, ".")))
+	}
+	return e
+}
+
+// allowed reports whether host is one of the allowed hosts or a subdomain
+// of one; player.vimeo.com is allowed by vimeo.com.
+func (e *embedder) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range e.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// frameSources is the CSP frame-src for the iframes embeds may contain.
+func (e *embedder) frameSources() string {
+	var sources []string
+	for _, h := range e.hosts {
+		sources = append(sources, "https://"+h, "https://*."+h)
+	}
+	return strings.Join(sources, " ")
+}
+
+func (e *embedder) resolve(ctx context.Context, rawURL string) (template.HTML, error) {
+	u, ok := httpURL(rawURL)
+	if !ok || !e.allowed(u.Hostname()) {
+		return "", errors.New("not an allowed embed host")
+	}
+	e.mu.Lock()
+	entry, ok := e.cache[rawURL]
+	e.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.html, entry.err
+	}
+
+	out, ttl, err := e.fetch(ctx, rawURL)
+	if err != nil {
+		ttl = embedFailureTTL
+		if ctx.Err() != nil {
+			// The page view gave up waiting; another one may have more time.
+			return "", err
+		}
+	}
+	e.mu.Lock()
+	if len(e.cache) >= embedCacheEntries {
+		e.cache = map[string]embedEntry{}
+	}
+	e.cache[rawURL] = embedEntry{out, err, time.Now().Add(ttl)}
+	e.mu.Unlock()
+	return out, err
+}
+
+type oEmbed struct {
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	HTML     string `json:"html"`
+	Width    any    `json:"width"`
+	Height   any    `json:"height"`
+	CacheAge any    `json:"cache_age"`
+}
+
+func (e *embedder) fetch(ctx context.Context, rawURL string) (template.HTML, time.Duration, error) {
+	endpoint, err := e.discover(ctx, rawURL)
+	if err != nil {
+		return "", 0, err
+	}
+	body, err := e.get(ctx, endpoint)
+	if err != nil {
+		return "", 0, err
+	}
+	var oe oEmbed
+	if err := json.Unmarshal(body, &oe); err != nil {
+		return "", 0, fmt.Errorf("oEmbed response: %w", err)
+	}
+	ttl := embedCacheTTL
+	if age, ok := number(oe.CacheAge); ok && age > 0 {
+		ttl = min(time.Duration(age)*time.Second, 7*embedCacheTTL)
+	}
+	out, err := e.embedHTML(oe)
+	return out, ttl, err
+}
+
+// get fetches a URL on an allowed host, following redirects only while
+// they stay on allowed hosts.
+func (e *embedder) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *publicClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 || !e.allowed(req.URL.Hostname()) {
+			return errors.New("redirected away from the allowed embed hosts")
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+}
+
+// discover finds the JSON oEmbed endpoint a page advertises. The endpoint
+// must be on an allowed host too.
+func (e *embedder) discover(ctx context.Context, rawURL string) (string, error) {
+	page, err := e.get(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(strings.NewReader(string(page)))
+	if err != nil {
+		return "", err
+	}
+	var endpoint string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if endpoint != "" {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link &&
+			strings.EqualFold(attr(n, "type"), "application/json+oembed") {
+			endpoint = attr(n, "href")
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if endpoint == "" {
+		return "", errors.New("page offers no oEmbed")
+	}
+	base, _ := url.Parse(rawURL)
+	ref, err := base.Parse(endpoint)
+	if err != nil || !e.allowed(ref.Hostname()) {
+		return "", errors.New("oEmbed endpoint is not on an allowed host")
+	}
+	return ref.String(), nil
+}
+
+// embedHTML builds the markup for an oEmbed response itself rather than
+// trusting the provider's: photos become an <img>, and videos and rich
+// embeds keep only the https src and size of the provider's iframe.
+func (e *embedder) embedHTML(oe oEmbed) (template.HTML, error) {
+	width, _ := number(oe.Width)
+	height, _ := number(oe.Height)
+	size := ""
+	if width > 0 && height > 0 {
+		size = ` width="` + strconv.Itoa(width) + `" height="` + strconv.Itoa(height) + `"`
+	}
+	title := template.HTMLEscapeString(oe.Title)
+	switch oe.Type {
+	case "photo":
+		u, ok := httpURL(oe.URL)
+		if !ok || u.Scheme != "https" {
+			return "", errors.New("photo embed without an https URL")
+		}
+		return template.HTML(`<span class="embed embed-photo"><img src="` + template.HTMLEscapeString(u.String()) +
+			`" alt="` + title + `"` + size + ` loading="lazy"></span>`), nil
+	case "video", "rich":
+		src := iframeSrc(oe.HTML)
+		u, ok := httpURL(src)
+		if !ok || u.Scheme != "https" || !e.allowed(u.Hostname()) {
+			return "", errors.New("embed has no iframe on an allowed host")
+		}
+		return template.HTML(`<span class="embed embed-` + oe.Type + `"><iframe src="` + template.HTMLEscapeString(u.String()) +
+			`" title="` + title + `"` + size + ` loading="lazy" allowfullscreen referrerpolicy="strict-origin-when-cross-origin"></iframe></span>`), nil
+	}
+	return "", fmt.Errorf("cannot embed oEmbed type %q", oe.Type)
+}
+
+func iframeSrc(fragment string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return ""
+	}
+	var src string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if src != "" {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Iframe {
+			src = attr(n, "src")
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return src
+}
+
+// number reads an oEmbed size or cache age, which providers send as
+// either JSON numbers or strings.
+func number(v any) (int, bool) {
+	switch v := v.(type) {
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// embedShortcode renders {{< embed URL >}}.
+func (e *embedder) embedShortcode(ctx context.Context, args []string, named map[string]string) (template.HTML, error) {
+	if len(args) != 1 {
+		return "", errors.New("want one URL")
+	}
+	return e.resolve(ctx, args[0])
+}
+
+// bareURL embeds a URL written alone on its line, leaving it as it was
+// when it cannot be embedded.
+func (e *embedder) bareURL(ctx context.Context, rawURL string) (template.HTML, bool) {
+	out, err := e.resolve(ctx, rawURL)
+	return out, err == nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "sync"
+
+type EventKind int
+
+const (
+	EventPageSaved EventKind = iota
+)
+
+type Event struct {
+	Kind  EventKind
+	Title string
+}
+
+type EventHandler func(Event)
+
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[EventKind][]EventHandler
+}
+
+func newEventBus() *EventBus {
+	return &EventBus{handlers: map[EventKind][]EventHandler{}}
+}
+
+func (b *EventBus) Subscribe(kind EventKind, h EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[kind] = append(b.handlers[kind], h)
+}
+
+// Publish calls handlers synchronously; a handler that needs to do slow
+// work should hand it off to its own goroutine.
+func (b *EventBus) Publish(e Event) {
+	b.mu.RLock()
+	handlers := b.handlers[e.Kind]
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
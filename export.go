@@ -0,0 +1,264 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// exportLink returns where an exported page should link to another page:
+// the sibling file when that page is part of the export, otherwise the
+// page on the wiki when its public URL is known.
+type exportLink func(title string) string
+
+func (s *Server) exportLinks(included map[string]bool, ext string) exportLink {
+	return func(title string) string {
+		if included[title] || s.config.BaseURL == "" {
+			return title + ext
+		}
+		return strings.TrimSuffix(s.config.BaseURL, "/") + "/view/" + title
+	}
+}
+
+// markdownBody converts a page body to Markdown. Front matter is kept,
+// each line of text becomes its own paragraph as it does on the wiki, and
+// fenced blocks are copied unchanged.
+func markdownBody(body []byte, link exportLink) []byte {
+	_, content, err := parseFrontMatter(body)
+	if err != nil {
+		content = body
+	}
+	var b bytes.Buffer
+	b.Write(body[:len(body)-len(content)])
+	for _, seg := range splitBlocks(content) {
+		if seg.fenced {
+			header := strings.TrimSpace(seg.lang + " " + seg.args)
+			fmt.Fprintf(&b, "%s%s\n%s\n%s\n\n", fence, header, seg.content, fence)
+			continue
+		}
+		for _, line := range strings.Split(string(seg.content), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			text := wikiLink.ReplaceAllStringFunc(line, func(m string) string {
+				title := canonical(wikiLink.FindStringSubmatch(m)[1])
+				return "[" + title + "](" + link(title) + ")"
+			})
+			text = externalLink.ReplaceAllString(text, "[$2]($1)")
+			b.WriteString(text + "\n\n")
+		}
+	}
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+var viewHref = regexp.MustCompile(`href="/view/([\p{L}\p{N}]+)"`)
+var previewAttr = regexp.MustCompile(` data-preview="[^"]*"`)
+var leaveHref = regexp.MustCompile(`href="/leave\?url=([^"]*)"`)
+
+// htmlDocument renders a page as a standalone HTML file whose wiki links
+// point at link.
+func (s *Server) htmlDocument(ctx context.Context, p *Page, link exportLink) []byte {
+	meta, content, err := parseFrontMatter(p.Body)
+	if err != nil {
+		content = p.Body
+	}
+	out := string(s.renderContent(ctx, p, meta, content))
+	out = previewAttr.ReplaceAllString(out, "")
+	// Exports are read away from the wiki, so external links go straight
+	// to their site rather than through /leave.
+	out = leaveHref.ReplaceAllStringFunc(out, func(m string) string {
+		u, err := url.QueryUnescape(html.UnescapeString(leaveHref.FindStringSubmatch(m)[1]))
+		if err != nil {
+			return m
+		}
+		return `href="` + template.HTMLEscapeString(u) + `"`
+	})
+	out = viewHref.ReplaceAllStringFunc(out, func(m string) string {
+		return `href="` + template.HTMLEscapeString(link(viewHref.FindStringSubmatch(m)[1])) + `"`
+	})
+	title := template.HTMLEscapeString(p.Title)
+	return []byte("<!doctype html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + title +
+		"</title>\n</head>\n<body>\n<h1>" + title + "</h1>\n" + out + "\n</body>\n</html>\n")
+}
+
+// selectPages returns the pages named in titles, a list separated by
+// spaces, commas or newlines, plus those matching the query q.
+func (s *Server) selectPages(ctx context.Context, titles, q string) ([]*Page, error) {
+	seen := map[string]bool{}
+	var pages []*Page
+	for _, title := range strings.FieldsFunc(titles, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}) {
+		title = canonical(title)
+		if seen[title] {
+			continue
+		}
+		if !validTitle.MatchString(title) {
+			return nil, fmt.Errorf("invalid page title %q", title)
+		}
+		p, err := s.store.Load(ctx, title)
+		if errors.Is(err, errPageNotFound) {
+			return nil, fmt.Errorf("there is no page called %s", title)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen[title] = true
+		pages = append(pages, p)
+	}
+	if strings.TrimSpace(q) != "" {
+		query, err := parseQuery(q)
+		if err != nil {
+			return nil, err
+		}
+		results, err := s.runQuery(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range results {
+			if !seen[p.Title] {
+				seen[p.Title] = true
+				pages = append(pages, p)
+			}
+		}
+	}
+	return pages, nil
+}
+
+type exportForm struct {
+	Titles, Query, Format, Error string
+}
+
+// exportHandler offers a form for picking pages and answers a submitted
+// selection with a zip of Markdown or HTML files.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	form := exportForm{Titles: q.Get("titles"), Query: canonical(q.Get("q")), Format: q.Get("format")}
+	if form.Format != "html" {
+		form.Format = "md"
+	}
+	if form.Titles == "" && form.Query == "" {
+		s.renderTemplate(w, "export", form)
+		return
+	}
+
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	pages, err := s.selectPages(ctx, form.Titles, form.Query)
+	if err == nil && len(pages) == 0 {
+		err = errors.New("no pages match")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		storeError(w, err)
+		return
+	}
+	if err != nil {
+		form.Error = err.Error()
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		s.renderTemplate(w, "export", form)
+		return
+	}
+
+	included := map[string]bool{}
+	for _, p := range pages {
+		included[p.Title] = true
+	}
+	link := s.exportLinks(included, "."+form.Format)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, p := range pages {
+		data := markdownBody(s.redact(p.Body), link)
+		if form.Format == "html" {
+			data = s.htmlDocument(ctx, p, link)
+		}
+		f, err := zw.Create(p.Title + "." + form.Format)
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	w.Write(buf.Bytes())
+}
+
+// exportZipHandler streams every page's source as Title.txt, the layout
+// wiki import and /admin/import read back.
+func (s *Server) exportZipHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	sort.Strings(titles)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="wiki.zip"`)
+	zw := zip.NewWriter(w)
+	for _, title := range titles {
+		p, err := s.store.Load(ctx, title)
+		var f io.Writer
+		if err == nil {
+			f, err = zw.CreateHeader(&zip.FileHeader{Name: title + ".txt", Method: zip.Deflate, Modified: p.ModTime})
+		}
+		if err == nil {
+			_, err = f.Write(p.Body)
+		}
+		if err != nil {
+			// The response has started, so all that is left is to cut
+			// it short and leave the client with a broken archive.
+			log.Printf("export.zip: %s: %v", title, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("export.zip: %v", err)
+	}
+}
+
+var validMarkdownPath = regexp.MustCompile(`^/export/([\p{L}\p{N}]+)\.md$`)
+
+// markdownHandler serves one page as Markdown, with wiki links pointing
+// at sibling Title.md files.
+func (s *Server) markdownHandler(w http.ResponseWriter, r *http.Request) {
+	m := validMarkdownPath.FindStringSubmatch(canonical(r.URL.Path))
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	p, err := s.store.Load(ctx, m[1])
+	if errors.Is(err, errPageNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	body := markdownBody(s.redact(p.Body), func(title string) string { return title + ".md" })
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": p.Title + ".md"}))
+	w.Write(append(body, '\n'))
+}
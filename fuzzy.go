@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+type titleMatch struct {
+	Title    string
+	Distance int
+}
+
+// titleDistance scores how closely title matches query, case-insensitively:
+// 0 for a prefix, at most 1 when one contains the other, otherwise the edit
+// distance. ok is false when the two are too far apart to suggest.
+func titleDistance(query, title string) (d int, ok bool) {
+	q, t := strings.ToLower(query), strings.ToLower(title)
+	if q == "" {
+		return 0, false
+	}
+	if strings.HasPrefix(t, q) {
+		return 0, true
+	}
+	d = levenshtein([]rune(q), []rune(t))
+	if len([]rune(q)) >= 3 && (strings.Contains(t, q) || strings.Contains(q, t)) {
+		d = min(d, 1)
+	}
+	return d, d <= max(2, len([]rune(q))/3)
+}
+
+// fuzzyMatches returns up to limit titles close to query, best first.
+func fuzzyMatches(query string, titles []string, limit int) []string {
+	var matches []titleMatch
+	for _, title := range titles {
+		if d, ok := titleDistance(query, title); ok {
+			matches = append(matches, titleMatch{Title: title, Distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+
+	var result []string
+	for _, m := range matches {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, m.Title)
+	}
+	return result
+}
+
+// normalizeTitle folds the differences that make two titles look like
+// separate pages for the same thing: letter case, non-alphanumeric
+// characters, and a plural "s" or "es" at the end.
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	n := b.String()
+	switch {
+	case strings.HasSuffix(n, "ies") && len(n) > 4:
+		n = strings.TrimSuffix(n, "ies") + "y"
+	case strings.HasSuffix(n, "ses") || strings.HasSuffix(n, "xes") || strings.HasSuffix(n, "ches") || strings.HasSuffix(n, "shes"):
+		n = strings.TrimSuffix(n, "es")
+	case strings.HasSuffix(n, "s") && !strings.HasSuffix(n, "ss") && len(n) > 3:
+		n = strings.TrimSuffix(n, "s")
+	}
+	return n
+}
+
+// nearDuplicates returns existing titles that normalize to the same form as
+// title, other than title itself.
+func nearDuplicates(title string, titles []string) []string {
+	want := normalizeTitle(title)
+	var dups []string
+	for _, t := range titles {
+		if t != title && normalizeTitle(t) == want {
+			dups = append(dups, t)
+		}
+	}
+	return dups
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// galleryBlock renders a ```gallery block: one image per line, its https
+// URL followed by an optional caption. Each image links to itself with
+// data-lightbox and data-caption attributes, for a lightbox script to
+// pick up. cols=N sets the number of columns (3 by default).
+func galleryBlock(ctx context.Context, args string, content []byte) (template.HTML, error) {
+	cols := 3
+	for _, opt := range strings.Fields(args) {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "cols":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 12 {
+				return "", errors.New("cols must be between 1 and 12")
+			}
+			cols = n
+		default:
+			return "", fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="gallery" style="display: grid; grid-template-columns: repeat(` + strconv.Itoa(cols) + `, 1fr); gap: 0.5em">`)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rawURL, caption, _ := strings.Cut(line, " ")
+		u, ok := httpURL(rawURL)
+		if !ok || u.Scheme != "https" {
+			return "", fmt.Errorf("line %d: images need an https URL", i+1)
+		}
+		src := template.HTMLEscapeString(u.String())
+		caption = template.HTMLEscapeString(strings.TrimSpace(caption))
+		b.WriteString(`<figure style="margin: 0"><a href="` + src + `" data-lightbox="gallery" data-caption="` + caption + `">` +
+			`<img src="` + src + `" alt="` + caption + `" loading="lazy" style="width: 100%; aspect-ratio: 1; object-fit: cover"></a>`)
+		if caption != "" {
+			b.WriteString(`<figcaption>` + caption + `</figcaption>`)
+		}
+		b.WriteString(`</figure>`)
+	}
+	b.WriteString(`</div>`)
+	return template.HTML(b.String()), nil
+}
@@ -1,3 +1,9 @@
 module github.com/goshatch/wiki
 
 go 1.22
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/net v0.35.0
+	golang.org/x/text v0.22.0
+)
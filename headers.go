@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultCSP = "default-src 'self'; img-src 'self' https: data:; style-src 'self' 'unsafe-inline'; object-src 'none'; base-uri 'self'; frame-src " + videoFrameSources
+
+type headerWriter struct {
+	http.ResponseWriter
+	s           *Server
+	wroteHeader bool
+}
+
+func (hw *headerWriter) WriteHeader(status int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.s.addSecurityHeaders(hw.Header())
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *headerWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *headerWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// addSecurityHeaders applies the configured policies. nosniff goes on
+// every response, so page text served as Markdown or JSON cannot be
+// loaded as a script; the rest only matter for HTML. Handlers that write
+// other content types set Content-Type before writing, and templates
+// leave it empty for net/http to sniff as HTML.
+func (s *Server) addSecurityHeaders(h http.Header) {
+	h.Set("X-Content-Type-Options", "nosniff")
+	ct := h.Get("Content-Type")
+	if ct != "" && !strings.HasPrefix(ct, "text/html") {
+		return
+	}
+	csp := s.config.ContentSecurityPolicy
+	if s.embeds != nil && csp != "" {
+		csp = addFrameSources(csp, s.embeds.frameSources())
+	}
+	if s.config.FrameAncestors != "" {
+		if csp != "" {
+			csp += "; "
+		}
+		csp += "frame-ancestors " + s.config.FrameAncestors
+	}
+	if csp != "" {
+		h.Set("Content-Security-Policy", csp)
+	}
+	if s.config.ReferrerPolicy != "" {
+		h.Set("Referrer-Policy", s.config.ReferrerPolicy)
+	}
+}
+
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headerWriter{ResponseWriter: w, s: s}, r)
+	})
+}
+
+// crossSiteRoutes take POSTs from other sites by design, authenticated by
+// a token in the path or verified out of band.
+var crossSiteRoutes = []string{"/api/email/", "/api/inbound/", "/webmention"}
+
+// sameOrigin reports whether a request came from the wiki's own pages,
+// going by Fetch Metadata or, in older browsers, the Origin header.
+// Requests with neither come from scripts or curl rather than a browser
+// on another site, and are let through.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+	return true
+}
+
+// checkOrigin refuses state-changing requests that another site's page
+// made a browser send, so a link or form elsewhere cannot save pages or
+// use the wiki's origin to render content.
+func (s *Server) checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || sameOrigin(r) || s.corsAllowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range crossSiteRoutes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "Cross-site request refused", http.StatusForbidden)
+	})
+}
+
+// addFrameSources adds sources to the frame-src directive of csp, creating
+// the directive if there is none.
+func addFrameSources(csp, sources string) string {
+	directives := strings.Split(csp, ";")
+	for i, d := range directives {
+		if name, _, _ := strings.Cut(strings.TrimSpace(d), " "); name == "frame-src" {
+			directives[i] = strings.TrimRight(d, " ") + " " + sources
+			return strings.Join(directives, ";")
+		}
+	}
+	return csp + "; frame-src " + sources
+}
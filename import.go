@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+type importEntry struct {
+	Name   string
+	Title  string
+	Status string
+	// Problem is set when the entry cannot be imported.
+	Problem string
+	page    *Page
+}
+
+type importForm struct {
+	DryRun    bool
+	Overwrite bool
+	Imported  bool
+	Error     string
+	Entries   []importEntry
+	Problems  int
+}
+
+// readImportZip turns each .txt file in the archive into a page, the same
+// layout `wiki export` writes. Directories inside the archive are ignored.
+func (s *Server) readImportZip(ctx context.Context, data []byte, overwrite bool) ([]importEntry, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var entries []importEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || path.Ext(f.Name) != ".txt" {
+			continue
+		}
+		e := importEntry{Name: f.Name, Title: canonical(strings.TrimSuffix(path.Base(f.Name), ".txt"))}
+		switch {
+		case !validTitle.MatchString(e.Title):
+			e.Problem = "invalid page title"
+		case seen[e.Title]:
+			e.Problem = "the archive has this page twice"
+		}
+		seen[e.Title] = true
+		replaces := false
+		if e.Problem == "" {
+			e.page, replaces, e.Problem, err = s.importPage(ctx, f, e.Title, overwrite)
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case e.Problem != "":
+			e.Status = "not imported"
+		case replaces:
+			e.Status = "replaces the existing page"
+		default:
+			e.Status = "new page"
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Title < entries[j].Title })
+	return entries, nil
+}
+
+// importTitles lists the titles the archive's pages would be saved under,
+// so an import can lock them before checking what already exists.
+func importTitles(data []byte) []string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+	var titles []string
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() && path.Ext(f.Name) == ".txt" {
+			titles = append(titles, canonical(strings.TrimSuffix(path.Base(f.Name), ".txt")))
+		}
+	}
+	return titles
+}
+
+// importPage reads one archive file and checks it like a save would,
+// reporting whether it would replace an existing page. Problems with the
+// page are returned as a message; only storage failures are errors.
+func (s *Server) importPage(ctx context.Context, f *zip.File, title string, overwrite bool) (p *Page, replaces bool, problem string, err error) {
+	_, err = s.store.Load(ctx, title)
+	if err != nil && !errors.Is(err, errPageNotFound) {
+		return nil, false, "", err
+	}
+	replaces = err == nil
+	if replaces && !overwrite {
+		return nil, true, "a page with this title already exists", nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, replaces, err.Error(), nil
+	}
+	defer rc.Close()
+	var r io.Reader = rc
+	if max := s.config.MaxPageBytes; max > 0 {
+		r = io.LimitReader(rc, max+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, replaces, err.Error(), nil
+	}
+	p = &Page{Title: title, Body: []byte(canonical(string(body)))}
+	if err := s.validatePage(ctx, p); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, replaces, "", err
+		}
+		return nil, replaces, err.Error(), nil
+	}
+	return p, replaces, "", nil
+}
+
+// importHandler loads a zip of pages. Nothing is saved unless every page
+// in it can be imported and dry run is off, so a report can be checked
+// first and a bad archive never half-applies.
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	form := importForm{DryRun: true}
+	if r.Method != http.MethodPost {
+		s.renderTemplate(w, "import", form)
+		return
+	}
+	err := r.ParseMultipartForm(8 << 20)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Cannot parse form", http.StatusBadRequest)
+		return
+	}
+	form.DryRun = r.FormValue("dryrun") != ""
+	form.Overwrite = r.FormValue("overwrite") != ""
+
+	file, _, err := r.FormFile("archive")
+	if err != nil {
+		form.Error = "choose a zip file to import"
+		s.renderTemplate(w, "import", form)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	if !form.DryRun {
+		// Hold the locks from the existence and validation checks to the
+		// saves, so a page written in between is neither overwritten nor
+		// saved over with a stale check.
+		unlock := s.locks.Lock(importTitles(data)...)
+		defer unlock()
+	}
+	form.Entries, err = s.readImportZip(ctx, data, form.Overwrite)
+	if errors.Is(err, zip.ErrFormat) {
+		form.Error = "the file is not a zip archive"
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		s.renderTemplate(w, "import", form)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	for _, e := range form.Entries {
+		if e.Problem != "" {
+			form.Problems++
+		}
+	}
+	switch {
+	case len(form.Entries) == 0:
+		form.Error = "the archive has no .txt pages"
+	case form.Problems > 0 && !form.DryRun:
+		form.Error = fmt.Sprintf("nothing was imported: %d pages have problems", form.Problems)
+	}
+	if form.DryRun || form.Error != "" {
+		s.renderTemplate(w, "import", form)
+		return
+	}
+
+	for _, e := range form.Entries {
+		if err := s.store.Save(ctx, e.page); err != nil {
+			storeError(w, err)
+			return
+		}
+		s.events.Publish(Event{Kind: EventPageSaved, Title: e.Title})
+	}
+	form.Imported = true
+	s.renderTemplate(w, "import", form)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// inboundHook appends POSTed JSON payloads to Page, formatted by Template.
+// It is an html/template, as page text renders as HTML: values from the
+// payload are escaped and only the template itself can add markup.
+type inboundHook struct {
+	Token    string `json:"token"`
+	Page     string `json:"page"`
+	Template string `json:"template"`
+
+	tmpl *template.Template
+}
+
+// loadInboundHooks reads the hooks file, a JSON list of inboundHook. Every
+// hook needs its own token, a valid page title and a template.
+func loadInboundHooks(path string) (map[string]*inboundHook, error) {
+	hooks := map[string]*inboundHook{}
+	if path == "" {
+		return hooks, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []*inboundHook
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	funcs := template.FuncMap{
+		"now": func() string { return time.Now().Format("2006-01-02 15:04") },
+	}
+	for i, h := range list {
+		h.Page = canonical(h.Page)
+		switch {
+		case h.Token == "":
+			return nil, fmt.Errorf("%s: hook %d has no token", path, i+1)
+		case hooks[h.Token] != nil:
+			return nil, fmt.Errorf("%s: hook %d reuses a token", path, i+1)
+		case !validTitle.MatchString(h.Page):
+			return nil, fmt.Errorf("%s: hook %d: invalid page title %q", path, i+1, h.Page)
+		}
+		h.tmpl, err = template.New(h.Page).Funcs(funcs).Parse(h.Template)
+		if err != nil {
+			return nil, fmt.Errorf("%s: hook %d: %w", path, i+1, err)
+		}
+		hooks[h.Token] = h
+	}
+	return hooks, nil
+}
+
+// appendToPage adds text to the end of title, creating the page if it does
+// not exist. It takes the page's lock, as /save does, so a delivery and an
+// edit cannot overwrite each other.
+func (s *Server) appendToPage(ctx context.Context, title, text string) error {
+	unlock := s.locks.Lock(title)
+	defer unlock()
+	p, err := s.store.Load(ctx, title)
+	if errors.Is(err, errPageNotFound) {
+		p = &Page{Title: title}
+	} else if err != nil {
+		return err
+	}
+	body := strings.TrimRight(string(p.Body), "\n")
+	if body != "" {
+		body += "\n\n"
+	}
+	p.Body = []byte(canonical(body + strings.TrimSpace(text) + "\n"))
+	if err := s.validatePage(ctx, p); err != nil {
+		return err
+	}
+	if err := s.store.Save(ctx, p); err != nil {
+		return err
+	}
+	s.events.Publish(Event{Kind: EventPageSaved, Title: title})
+	return nil
+}
+
+func validToken(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func appendError(w http.ResponseWriter, err error) {
+	status := http.StatusUnprocessableEntity
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// inboundHandler formats a JSON payload with the template of the hook
+// whose token is in the path and appends the result to the hook's page.
+func (s *Server) inboundHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST a JSON payload"})
+		return
+	}
+	got := strings.TrimPrefix(r.URL.Path, "/api/inbound/")
+	var hook *inboundHook
+	for token, h := range s.inbound {
+		if validToken(got, token) {
+			hook = h
+		}
+	}
+	if hook == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown token"})
+		return
+	}
+	var payload any
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	var b strings.Builder
+	if err := hook.tmpl.Execute(&b, payload); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	if err := s.appendToPage(ctx, hook.Page, b.String()); err != nil {
+		appendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"title": hook.Page})
+}
+
+// titleFromSubject turns an email subject such as "Re: meeting notes" into
+// a title like MeetingNotes.
+func titleFromSubject(subject string) string {
+	for {
+		lower := strings.ToLower(strings.TrimSpace(subject))
+		prefix := ""
+		for _, p := range []string{"re:", "fwd:", "fw:"} {
+			if strings.HasPrefix(lower, p) {
+				prefix = p
+			}
+		}
+		if prefix == "" {
+			break
+		}
+		subject = strings.TrimSpace(subject)[len(prefix):]
+	}
+	return titleFromPhrase(subject)
+}
+
+// emailText returns the plain text of a message, taking the first
+// text/plain part of a multipart message.
+func emailText(header textHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return "", errors.New("message has no text/plain part")
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := emailText(part.Header, part)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", fmt.Errorf("cannot use %s content", mediaType)
+	}
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	return string(data), err
+}
+
+type textHeader interface {
+	Get(key string) string
+}
+
+// addressedTo reports whether the message was sent to addr, looking at the
+// recipient headers gateways usually preserve.
+func addressedTo(h mail.Header, addr string) bool {
+	for _, key := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		list, err := h.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, a := range list {
+			if strings.EqualFold(a.Address, addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emailHandler accepts a raw RFC 822 message, as forwarded by a mail
+// provider's inbound webhook, and appends its text to the page named by
+// the subject.
+func (s *Server) emailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST a raw email message"})
+		return
+	}
+	if !validToken(strings.TrimPrefix(r.URL.Path, "/api/email/"), s.config.InboundEmailToken) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown token"})
+		return
+	}
+	msg, err := mail.ReadMessage(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if addr := s.config.InboundEmailAddress; addr != "" && !addressedTo(msg.Header, addr) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "message is not addressed to " + addr})
+		return
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	title := titleFromSubject(subject)
+	if !validTitle.MatchString(title) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "subject does not make a page title"})
+		return
+	}
+	text, err := emailText(msg.Header, msg.Body)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+
+	from := msg.Header.Get("From")
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+		if addr.Name != "" {
+			from = addr.Name
+		}
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		date = time.Now()
+	}
+	// Page text is rendered as HTML, so the sender's words are escaped to
+	// show as written rather than as markup.
+	entry := fmt.Sprintf("Email from %s, %s:\n\n%s", html.EscapeString(from), date.Format("2006-01-02 15:04"), html.EscapeString(text))
+
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	if err := s.appendToPage(ctx, title, entry); err != nil {
+		appendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"title": title})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type journalDay struct {
+	Day   int
+	Title string
+}
+
+type journalMonth struct {
+	Label string
+	// Weeks run Monday to Sunday; days outside the month have Day 0.
+	Weeks [][7]journalDay
+}
+
+// todayHandler opens the page for the current date, or an editor for it
+// filled in from the journal template. The page is only created when that
+// editor is saved, so a crawler or prefetch following /today writes
+// nothing and the page goes through the same checks as any other save.
+func (s *Server) todayHandler(w http.ResponseWriter, r *http.Request) {
+	title := time.Now().Format(s.settings.Get("journal_format"))
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+
+	_, err := s.store.Load(ctx, title)
+	if err == nil {
+		http.Redirect(w, r, "/view/"+title, http.StatusFound)
+		return
+	}
+	if !errors.Is(err, errPageNotFound) {
+		storeError(w, err)
+		return
+	}
+
+	p := &Page{Title: title}
+	if tmpl := s.settings.Get("journal_template"); tmpl != "" {
+		t, err := s.store.Load(ctx, tmpl)
+		if err != nil && !errors.Is(err, errPageNotFound) {
+			storeError(w, err)
+			return
+		}
+		if err == nil {
+			p.Body = t.Body
+		}
+	}
+	if p.Body == nil {
+		http.Redirect(w, r, "/edit/"+title, http.StatusFound)
+		return
+	}
+	s.renderTemplate(w, "edit", editForm{Page: p})
+}
+
+func (s *Server) journalHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	format := s.settings.Get("journal_format")
+	byDay := map[time.Time]string{}
+	var days []time.Time
+	for _, title := range titles {
+		day, err := time.Parse(format, title)
+		if err != nil || day.Format(format) != title {
+			continue
+		}
+		byDay[day] = title
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].After(days[j]) })
+
+	var months []journalMonth
+	for _, day := range days {
+		first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		label := first.Format("January 2006")
+		if len(months) > 0 && months[len(months)-1].Label == label {
+			continue
+		}
+		months = append(months, journalMonth{Label: label, Weeks: monthWeeks(first, byDay)})
+	}
+	s.renderTemplate(w, "journal", months)
+}
+
+func monthWeeks(first time.Time, byDay map[time.Time]string) [][7]journalDay {
+	var weeks [][7]journalDay
+	var week [7]journalDay
+	col := (int(first.Weekday()) + 6) % 7
+	for d := first; d.Month() == first.Month(); d = d.AddDate(0, 0, 1) {
+		week[col] = journalDay{Day: d.Day(), Title: byDay[d]}
+		col++
+		if col == 7 {
+			weeks = append(weeks, week)
+			week = [7]journalDay{}
+			col = 0
+		}
+	}
+	if col > 0 {
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// leaveHandler shows a confirmation page before following an external
+// link. It never redirects by itself, and only http(s) URLs are offered.
+func (s *Server) leaveHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid link", http.StatusBadRequest)
+		return
+	}
+	log.Printf("leave: %s (from %s)", u, r.Referer())
+	s.renderTemplate(w, "leave", struct {
+		URL  string
+		Host string
+		From string
+	}{u.String(), u.Host, r.Referer()})
+}
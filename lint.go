@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type LintWarning struct {
+	Line    int
+	Check   string
+	Message string
+	// Target is the missing page of a missing-link warning.
+	Target string
+}
+
+// LintCheck inspects a page about to be saved. Warnings never stop a save
+// unless the server runs in strict lint mode.
+type LintCheck func(ctx context.Context, p *Page) ([]LintWarning, error)
+
+const lintMaxLineRunes = 1000
+
+var todoMarker = regexp.MustCompile(`\b(TODO|FIXME|XXX)\b`)
+
+func (s *Server) AddLintCheck(c LintCheck) {
+	s.linters = append(s.linters, c)
+}
+
+func (s *Server) lintPage(ctx context.Context, p *Page) ([]LintWarning, error) {
+	var warnings []LintWarning
+	for _, c := range s.linters {
+		w, err := c(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, w...)
+	}
+	return warnings, nil
+}
+
+// lintLines checks each line of the body. Line numbers count the whole
+// body, as the editor shows it; fenced blocks are only checked for
+// trailing whitespace.
+func lintLines(ctx context.Context, p *Page) ([]LintWarning, error) {
+	var warnings []LintWarning
+	for i, line := range strings.Split(string(p.Body), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimRight(line, " \t") != line {
+			warnings = append(warnings, LintWarning{Line: i + 1, Check: "trailing-space", Message: "trailing whitespace"})
+		}
+	}
+	for _, seg := range splitBlocks(p.Body) {
+		if seg.fenced {
+			continue
+		}
+		for i, line := range strings.Split(string(seg.content), "\n") {
+			if n := utf8.RuneCountInString(line); n > lintMaxLineRunes {
+				warnings = append(warnings, LintWarning{Line: seg.line + i, Check: "long-line", Message: fmt.Sprintf("line is %d characters long", n)})
+			}
+			if m := todoMarker.FindString(line); m != "" {
+				warnings = append(warnings, LintWarning{Line: seg.line + i, Check: "todo", Message: m + " marker"})
+			}
+		}
+	}
+	// Report in line order, as the checks above ran in two passes.
+	sort.SliceStable(warnings, func(i, j int) bool { return warnings[i].Line < warnings[j].Line })
+	return warnings, nil
+}
+
+// lintMissingLinks warns about [[links]] to pages that do not exist.
+func (s *Server) lintMissingLinks(ctx context.Context, p *Page) ([]LintWarning, error) {
+	var warnings []LintWarning
+	seen := map[string]bool{}
+	// Front matter values are not rendered, so links in them do not
+	// count; offset keeps line numbers relative to the whole body.
+	_, content, err := parseFrontMatter(p.Body)
+	if err != nil {
+		content = p.Body
+	}
+	offset := bytes.Count(p.Body[:len(p.Body)-len(content)], []byte("\n"))
+	for _, seg := range splitBlocks(content) {
+		if seg.fenced {
+			continue
+		}
+		for i, line := range strings.Split(string(seg.content), "\n") {
+			for _, m := range wikiLink.FindAllStringSubmatch(line, -1) {
+				target := canonical(m[1])
+				if seen[target] || target == p.Title {
+					continue
+				}
+				seen[target] = true
+				_, err := s.store.Load(ctx, target)
+				if errors.Is(err, errPageNotFound) {
+					warnings = append(warnings, LintWarning{offset + seg.line + i, "missing-link", "links to " + target + ", which does not exist", target})
+				} else if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// validateLint turns lint warnings into a save error in strict mode.
+func (s *Server) validateLint(ctx context.Context, p *Page) error {
+	if !s.config.LintStrict {
+		return nil
+	}
+	warnings, err := s.lintPage(ctx, p)
+	if err != nil || len(warnings) == 0 {
+		return err
+	}
+	msgs := make([]string, len(warnings))
+	for i, w := range warnings {
+		msgs[i] = fmt.Sprintf("line %d: %s", w.Line, w.Message)
+	}
+	return errors.New("lint: " + strings.Join(msgs, "; "))
+}
+
+// stubHandler creates a placeholder for a page another page links to, so
+// missing links can be fixed from the lint warnings without leaving the
+// page. An existing page is left alone.
+func (s *Server) stubHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !parseForm(w, r) {
+		return
+	}
+	from := canonical(r.FormValue("from"))
+	if !validTitle.MatchString(from) {
+		http.Error(w, "Missing or invalid linking page", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	unlock := s.locks.Lock(title)
+	defer unlock()
+	_, err := s.store.Load(ctx, title)
+	if errors.Is(err, errPageNotFound) {
+		p := &Page{Title: title, Body: []byte("Linked from [[" + from + "]].\n")}
+		if err := s.validatePage(ctx, p); err != nil {
+			http.Error(w, "Cannot create "+title+": "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := s.store.Save(ctx, p); err != nil {
+			storeError(w, err)
+			return
+		}
+		s.events.Publish(Event{Kind: EventPageSaved, Title: title})
+	} else if err != nil {
+		storeError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/view/"+from+"?lint=1", http.StatusFound)
+}
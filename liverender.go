@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// apiRenderHandler renders page source sent by the editor into the HTML
+// fragment /view/ would show, for a live preview. The source is POSTed as
+// a form field or the raw request body, and goes through renderContent,
+// which sanitizes it like any page. An ETag of the result lets a preview
+// skip repainting when nothing changed.
+func (s *Server) apiRenderHandler(w http.ResponseWriter, r *http.Request) {
+	var source string
+	switch r.Method {
+	case http.MethodPost:
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			if !parseForm(w, r) {
+				return
+			}
+			source = r.PostForm.Get("body")
+			break
+		}
+		data, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		source = string(data)
+	default:
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	meta, content, err := parseFrontMatter([]byte(canonical(source)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	html := string(s.renderContent(ctx, &Page{Title: canonical(r.FormValue("title"))}, meta, content))
+
+	sum := sha256.Sum256([]byte(html))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, html)
+}
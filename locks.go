@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+type titleLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockManager serializes read-modify-write sequences per title, such as
+// loading a page, checking it for conflicts and saving it. Entries are removed
+// once nobody holds or waits on them, so the map only grows with the
+// number of titles being written concurrently.
+type lockManager struct {
+	mu    sync.Mutex
+	locks map[string]*titleLock
+}
+
+func newLockManager() *lockManager {
+	return &lockManager{locks: map[string]*titleLock{}}
+}
+
+// Lock acquires the locks for all given titles and returns a function that
+// releases them. Titles are locked in sorted order so that operations
+// touching several pages cannot deadlock against each other.
+func (m *lockManager) Lock(titles ...string) (unlock func()) {
+	sorted := append([]string(nil), titles...)
+	sort.Strings(sorted)
+
+	var held []string
+	for i, title := range sorted {
+		if i > 0 && title == sorted[i-1] {
+			continue
+		}
+		m.mu.Lock()
+		l, ok := m.locks[title]
+		if !ok {
+			l = &titleLock{}
+			m.locks[title] = l
+		}
+		l.refs++
+		m.mu.Unlock()
+
+		l.mu.Lock()
+		held = append(held, title)
+	}
+
+	return func() {
+		for _, title := range held {
+			m.mu.Lock()
+			l := m.locks[title]
+			l.refs--
+			if l.refs == 0 {
+				delete(m.locks, title)
+			}
+			m.mu.Unlock()
+			l.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memPage struct {
+	body    []byte
+	modTime time.Time
+}
+
+type memStore struct {
+	mu    sync.RWMutex
+	pages map[string]memPage
+}
+
+func newMemStore() *memStore {
+	return &memStore{pages: map[string]memPage{}}
+}
+
+func (s *memStore) Load(ctx context.Context, title string) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mp, ok := s.pages[title]
+	if !ok {
+		return nil, errPageNotFound
+	}
+	return &Page{Title: title, Body: append([]byte(nil), mp.body...), ModTime: mp.modTime}, nil
+}
+
+func (s *memStore) Save(ctx context.Context, p *Page) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[p.Title] = memPage{body: append([]byte(nil), p.Body...), modTime: time.Now()}
+	return nil
+}
+
+func (s *memStore) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	titles := make([]string, 0, len(s.pages))
+	for title := range s.pages {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	return titles, nil
+}
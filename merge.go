@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+type mergeForm struct {
+	From, Into string
+	Prepend    bool
+	Error      string
+	Merged     bool
+	Rewritten  []string
+}
+
+func (s *Server) mergeHandler(w http.ResponseWriter, r *http.Request) {
+	var form mergeForm
+	if r.Method != http.MethodPost {
+		s.renderTemplate(w, "merge", form)
+		return
+	}
+	if !parseForm(w, r) {
+		return
+	}
+	form.From, form.Into = canonical(r.FormValue("from")), canonical(r.FormValue("into"))
+	form.Prepend = r.FormValue("position") == "prepend"
+
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	rewritten, err := s.mergePages(ctx, form.From, form.Into, form.Prepend)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			storeError(w, err)
+			return
+		}
+		form.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		form.Merged, form.Rewritten = true, rewritten
+	}
+	s.renderTemplate(w, "merge", form)
+}
+
+// mergePages moves from's text into into, points every [[from]] link in
+// the wiki at into, and turns from into a redirect. It returns the titles
+// of the pages whose links were rewritten.
+func (s *Server) mergePages(ctx context.Context, from, into string, prepend bool) ([]string, error) {
+	if !validTitle.MatchString(from) || !validTitle.MatchString(into) {
+		return nil, errors.New("both titles must be valid page titles")
+	}
+	if from == into {
+		return nil, errors.New("cannot merge a page into itself")
+	}
+	// Merging rewrites pages all over the wiki, so it holds every title
+	// until it is done; merges are rare enough for saves to wait.
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlock := s.locks.Lock(append(titles, from, into)...)
+	defer unlock()
+	src, err := s.store.Load(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", from, err)
+	}
+	dst, err := s.store.Load(ctx, into)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", into, err)
+	}
+
+	_, srcContent, err := parseFrontMatter(src.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", from, err)
+	}
+	_, dstContent, err := parseFrontMatter(dst.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", into, err)
+	}
+	header := dst.Body[:len(dst.Body)-len(dstContent)]
+	parts := [][]byte{bytes.TrimRight(dstContent, "\n"), bytes.TrimRight(srcContent, "\n")}
+	if prepend {
+		parts[0], parts[1] = parts[1], parts[0]
+	}
+	merged := &Page{Title: into, Body: append(append([]byte(nil), header...), bytes.Join(parts, []byte("\n\n"))...)}
+
+	link := regexp.MustCompile(`\[\[` + regexp.QuoteMeta(from) + `\]\]`)
+	var relinked []*Page
+	for _, title := range titles {
+		if title == from || title == into {
+			continue
+		}
+		p, err := s.store.Load(ctx, title)
+		if err != nil {
+			return nil, err
+		}
+		if link.Match(p.Body) {
+			p.Body = link.ReplaceAll(p.Body, []byte("[["+into+"]]"))
+			relinked = append(relinked, p)
+		}
+	}
+	intoRelinked := link.Match(merged.Body)
+	if intoRelinked {
+		merged.Body = link.ReplaceAll(merged.Body, []byte("[["+into+"]]"))
+	}
+	stub := &Page{Title: from, Body: []byte("---\nredirect: " + into + "\n---\nMerged into [[" + into + "]].\n")}
+
+	// Every page is checked before any is saved, so a page the validators
+	// refuse stops the merge instead of leaving it half done.
+	changed := append(append([]*Page{merged}, relinked...), stub)
+	for _, p := range changed {
+		if err := s.validatePage(ctx, p); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Title, err)
+		}
+	}
+	var rewritten []string
+	for _, p := range changed {
+		if err := s.savePageLocked(ctx, p); err != nil {
+			return rewritten, err
+		}
+		if p == stub || (p == merged && !intoRelinked) {
+			continue
+		}
+		rewritten = append(rewritten, p.Title)
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type Metadata struct {
+	Aliases    []string       `yaml:"aliases"`
+	Tags       []string       `yaml:"tags"`
+	Owners     []string       `yaml:"owners"`
+	Visibility string         `yaml:"visibility"`
+	Type       string         `yaml:"type"`
+	Schema     string         `yaml:"schema"`
+	Redirect   string         `yaml:"redirect"`
+	Archived   bool           `yaml:"archived"`
+	Expires    string         `yaml:"expires"`
+	NoIndex    bool           `yaml:"noindex"`
+	Review     string         `yaml:"review"`
+	Reviewed   string         `yaml:"reviewed"`
+	Fields     map[string]any `yaml:",inline"`
+}
+
+var frontMatterDelim = []byte("---")
+
+// parseFrontMatter splits an optional YAML block delimited by "---" lines
+// off the top of a page body. Bodies without one are returned unchanged
+// with empty metadata.
+func parseFrontMatter(body []byte) (Metadata, []byte, error) {
+	var meta Metadata
+	first, rest, ok := cutLine(body)
+	if !ok || !bytes.Equal(bytes.TrimSpace(first), frontMatterDelim) {
+		return meta, body, nil
+	}
+
+	block := rest
+	for offset := 0; offset <= len(rest); {
+		line, next, more := cutLine(rest[offset:])
+		if bytes.Equal(bytes.TrimSpace(line), frontMatterDelim) {
+			if err := yaml.Unmarshal(block[:offset], &meta); err != nil {
+				return Metadata{}, body, fmt.Errorf("front matter: %w", err)
+			}
+			return meta, next, nil
+		}
+		if !more {
+			break
+		}
+		offset = len(rest) - len(next)
+	}
+	return Metadata{}, body, fmt.Errorf("front matter: missing closing %q", frontMatterDelim)
+}
+
+func cutLine(b []byte) (line, rest []byte, ok bool) {
+	if len(b) == 0 {
+		return nil, nil, false
+	}
+	line, rest, found := bytes.Cut(b, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), rest, found
+}
+
+func validateFrontMatter(ctx context.Context, p *Page) error {
+	meta, _, err := parseFrontMatter(p.Body)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(meta.Visibility) {
+	case "", "public", "private":
+		return nil
+	}
+	return fmt.Errorf("visibility must be public or private, not %q", meta.Visibility)
+}
+
+// private reports whether a page is marked visibility: private. There are
+// no accounts, so such a page can still be read by anyone with its URL; it
+// is only unlisted: left out of /all, queries and the exports they pick,
+// related pages, tasks and title suggestions, and hidden from search
+// engines. /go still jumps to it by its exact title, and the /export.zip
+// backup keeps it.
+func (m Metadata) private() bool {
+	return strings.EqualFold(m.Visibility, "private")
+}
+
+func withoutPrivate(pages []*Page) []*Page {
+	var listed []*Page
+	for _, p := range pages {
+		if !p.Meta.private() {
+			listed = append(listed, p)
+		}
+	}
+	return listed
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		content string
+		tags    int
+		wantErr bool
+	}{
+		{"none", "text\n", "text\n", 0, false},
+		{"block", "---\ntags: [a, b]\n---\ntext\n", "text\n", 2, false},
+		{"crlf", "---\r\ntags: [a]\r\n---\r\ntext", "text", 1, false},
+		{"empty block", "---\n---\ntext", "text", 0, false},
+		{"unclosed", "---\ntags: [a]\ntext", "---\ntags: [a]\ntext", 0, true},
+		{"bad yaml", "---\ntags: [a\n---\ntext", "---\ntags: [a\n---\ntext", 0, true},
+		{"rule later on", "text\n---\nmore", "text\n---\nmore", 0, false},
+	}
+	for _, tt := range tests {
+		meta, content, err := parseFrontMatter([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if string(content) != tt.content || len(meta.Tags) != tt.tags {
+			t.Errorf("%s: got content %q and tags %q", tt.name, content, meta.Tags)
+		}
+	}
+}
+
+func TestValidateVisibility(t *testing.T) {
+	for body, ok := range map[string]bool{
+		"---\nvisibility: private\n---\n": true,
+		"---\nvisibility: Public\n---\n":  true,
+		"---\nvisibility: secret\n---\n":  false,
+	} {
+		if err := validateFrontMatter(context.Background(), &Page{Body: []byte(body)}); (err == nil) != ok {
+			t.Errorf("validateFrontMatter(%q) = %v", body, err)
+		}
+	}
+}
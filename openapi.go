@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// apiRoute describes one /api route. Handler registers the routes from
+// this list and /api/openapi.json is built from it, so the document cannot
+// drift from what is served. Path is in OpenAPI form; each {name} in it is
+// a path parameter, and the mux pattern is the path up to the first one.
+type apiRoute struct {
+	path     string
+	method   string
+	summary  string
+	query    []string
+	consumes string
+	produces string
+	handler  http.HandlerFunc
+}
+
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{path: "/api/tasks", method: "GET", summary: "Open tasks on all listed pages", produces: "application/json", handler: s.apiTasksHandler},
+		{path: "/api/preview/{title}", method: "GET", summary: "Title and excerpt of a page, for link previews", produces: "application/json", handler: s.apiPreviewHandler},
+		{path: "/api/related/{title}", method: "GET", summary: "Pages sharing links and tags with a page", produces: "application/json", handler: s.apiRelatedHandler},
+		{path: "/api/quickswitch", method: "GET", summary: "Titles matching q, favouring the visitor's recent pages", query: []string{"q"}, produces: "application/json", handler: s.apiQuickSwitchHandler},
+		{path: "/api/suggest", method: "GET", summary: "OpenSearch suggestions for q", query: []string{"q"}, produces: "application/x-suggestions+json", handler: s.suggestHandler},
+		{path: "/api/convert", method: "POST", summary: "Convert pasted HTML into wiki source", consumes: "text/html", produces: "application/json", handler: s.apiConvertHandler},
+		{path: "/api/editor/{title}", method: "GET", summary: "A page as HTML for a WYSIWYG editor", produces: "application/json", handler: s.apiEditorHandler},
+		{path: "/api/render", method: "POST", summary: "Render page source into sanitized HTML, for live previews", consumes: "text/plain", produces: "text/html", handler: s.apiRenderHandler},
+		{path: "/api/spellcheck", method: "POST", summary: "Unknown words in text, with suggestions", consumes: "text/plain", produces: "application/json", handler: s.apiSpellcheckHandler},
+		{path: "/api/email/{token}", method: "POST", summary: "Append a raw email message to the page its subject names", consumes: "message/rfc822", produces: "application/json", handler: s.emailHandler},
+		{path: "/api/inbound/{token}", method: "POST", summary: "Append a webhook payload to the hook's page", consumes: "application/json", produces: "application/json", handler: s.inboundHandler},
+		{path: "/api/openapi.json", method: "GET", summary: "This document", produces: "application/json", handler: s.openAPIHandler},
+	}
+}
+
+func (r apiRoute) pattern() string {
+	pattern, _, _ := strings.Cut(r.path, "{")
+	return pattern
+}
+
+var pathParam = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// openAPIHandler serves an OpenAPI 3 description of the /api routes.
+// Bodies and responses are described by media type only.
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	paths := map[string]any{}
+	for _, route := range s.apiRoutes() {
+		var params []map[string]any
+		for _, m := range pathParam.FindAllStringSubmatch(route.path, -1) {
+			params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"}})
+		}
+		for _, name := range route.query {
+			params = append(params, map[string]any{"name": name, "in": "query", "schema": map[string]string{"type": "string"}})
+		}
+		op := map[string]any{
+			"summary": route.summary,
+			"responses": map[string]any{
+				"200": map[string]any{"description": "OK", "content": map[string]any{route.produces: map[string]any{}}},
+			},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if route.consumes != "" {
+			op["requestBody"] = map[string]any{"required": true, "content": map[string]any{route.consumes: map[string]any{}}}
+		}
+		paths[route.path] = map[string]any{strings.ToLower(route.method): op}
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": s.settings.Get("site_name"), "version": "1"},
+		"paths":   paths,
+	}
+	if s.config.BaseURL != "" {
+		doc["servers"] = []map[string]string{{"url": s.config.BaseURL}}
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
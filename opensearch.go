@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// titleFromPhrase joins the words of free text into a title, so "meeting
+// notes" becomes MeetingNotes.
+func titleFromPhrase(text string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		runes := []rune(word)
+		b.WriteRune(unicode.ToUpper(runes[0]))
+		b.WriteString(string(runes[1:]))
+	}
+	return canonical(b.String())
+}
+
+// goHandler is the target of the browser search keyword. There is no
+// full-text search, so it jumps to the page the words name, ignoring
+// case, and otherwise offers similar titles or the editor.
+func (s *Server) goHandler(w http.ResponseWriter, r *http.Request) {
+	title := titleFromPhrase(canonical(r.URL.Query().Get("q")))
+	if title == "" {
+		http.Redirect(w, r, "/all", http.StatusFound)
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	for _, t := range titles {
+		if strings.EqualFold(t, title) {
+			http.Redirect(w, r, "/view/"+t, http.StatusFound)
+			return
+		}
+	}
+	s.missingPage(ctx, w, r, title)
+}
+
+// suggestHandler answers browser search suggestions in the OpenSearch
+// suggestions format: the query followed by matching titles.
+func (s *Server) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := canonical(r.URL.Query().Get("q"))
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	results, err := s.quickSwitch(ctx, visitorID(w, r), q)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	titles := []string{}
+	for _, res := range results {
+		titles = append(titles, res.Title)
+	}
+	w.Header().Set("Content-Type", "application/x-suggestions+json")
+	json.NewEncoder(w).Encode([]any{q, titles})
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+// baseURL is the configured public URL, or one guessed from the request
+// when none is set.
+func (s *Server) baseURL(r *http.Request) string {
+	if s.config.BaseURL != "" {
+		return strings.TrimSuffix(s.config.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) openSearchHandler(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	name := s.settings.Get("site_name")
+	// ShortName is limited to 16 characters by the spec.
+	short := []rune(name)
+	if len(short) > 16 {
+		short = short[:16]
+	}
+	desc := openSearchDescription{
+		ShortName:     string(short),
+		Description:   "Go to a page of " + name,
+		InputEncoding: "UTF-8",
+		URLs: []openSearchURL{
+			{Type: "text/html", Template: base + "/go?q={searchTerms}"},
+			{Type: "application/x-suggestions+json", Template: base + "/api/suggest?q={searchTerms}"},
+		},
+	}
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(desc)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const excerptLength = 200
+
+var validPreviewPath = regexp.MustCompile(`^/api/preview/([\p{L}\p{N}]+)$`)
+
+// excerpt returns the opening text of a page body as plain text: front
+// matter and fenced blocks are dropped, links are reduced to their
+// text, and the result is cut at a word boundary near max runes.
+func excerpt(body []byte, max int) string {
+	_, content, err := parseFrontMatter(body)
+	if err != nil {
+		content = body
+	}
+	var words []string
+	for _, seg := range splitBlocks(content) {
+		if seg.fenced {
+			continue
+		}
+		text := wikiLink.ReplaceAll(seg.content, []byte("$1"))
+		text = externalLink.ReplaceAll(text, []byte("$2"))
+		words = append(words, strings.Fields(string(text))...)
+	}
+
+	var b strings.Builder
+	for _, w := range words {
+		if b.Len() > 0 && utf8.RuneCountInString(b.String())+1+utf8.RuneCountInString(w) > max {
+			b.WriteString("…")
+			break
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+type preview struct {
+	Title   string `json:"title"`
+	Excerpt string `json:"excerpt"`
+}
+
+func (s *Server) apiPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	m := validPreviewPath.FindStringSubmatch(canonical(r.URL.Path))
+	if m == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "invalid page title"})
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	p, err := s.store.Load(ctx, m[1])
+	if errors.Is(err, errPageNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "page not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, preview{Title: p.Title, Excerpt: excerpt(s.redact(p.Body), excerptLength)})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type predicate func(p *Page) bool
+
+type pageQuery struct {
+	// groups are alternatives joined by OR; a page matches when every
+	// predicate in at least one group holds.
+	groups [][]predicate
+	sort   string
+	limit  int
+	// archived is set when the query mentions archived: itself; otherwise
+	// archived pages are left out.
+	archived bool
+}
+
+// parseQuery understands tag:NAME, owner:NAME, title:TEXT, modified:>DATE
+// (or <, =, with DATE as YYYY-MM-DD), archived:true|false, bare words
+// matched against titles, a leading "-" to negate a term and OR between
+// terms. Terms are ANDed by default.
+// sort:title|modified and limit:N apply to the whole query.
+func parseQuery(q string) (pageQuery, error) {
+	query := pageQuery{sort: "title"}
+	var group []predicate
+	for _, term := range strings.Fields(q) {
+		if term == "OR" {
+			if len(group) == 0 {
+				return query, fmt.Errorf("OR needs a term on each side")
+			}
+			query.groups = append(query.groups, group)
+			group = nil
+			continue
+		}
+		negate := strings.HasPrefix(term, "-") && len(term) > 1
+		if negate {
+			term = term[1:]
+		}
+
+		key, value, ok := strings.Cut(term, ":")
+		var pred predicate
+		switch {
+		case !ok:
+			pred = titleContains(term)
+		case key == "sort":
+			if value != "title" && value != "modified" {
+				return query, fmt.Errorf("cannot sort by %q", value)
+			}
+			query.sort = value
+			continue
+		case key == "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return query, fmt.Errorf("invalid limit %q", value)
+			}
+			query.limit = n
+			continue
+		case key == "tag":
+			pred = hasTag(value)
+		case key == "owner":
+			pred = hasOwner(value)
+		case key == "title":
+			pred = titleContains(value)
+		case key == "archived":
+			want, err := strconv.ParseBool(value)
+			if err != nil {
+				return query, fmt.Errorf("invalid archived value %q", value)
+			}
+			query.archived = true
+			pred = func(p *Page) bool { return p.Archived == want }
+		case key == "modified":
+			var err error
+			pred, err = modifiedFilter(value)
+			if err != nil {
+				return query, err
+			}
+		default:
+			return query, fmt.Errorf("unknown filter %q", key)
+		}
+		if negate {
+			inner := pred
+			pred = func(p *Page) bool { return !inner(p) }
+		}
+		group = append(group, pred)
+	}
+	if len(group) == 0 && len(query.groups) > 0 {
+		return query, fmt.Errorf("OR needs a term on each side")
+	}
+	query.groups = append(query.groups, group)
+	return query, nil
+}
+
+func titleContains(text string) predicate {
+	text = strings.ToLower(text)
+	return func(p *Page) bool {
+		return strings.Contains(strings.ToLower(p.Title), text)
+	}
+}
+
+func hasTag(tag string) predicate {
+	return func(p *Page) bool {
+		for _, t := range p.Meta.Tags {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func hasOwner(owner string) predicate {
+	return func(p *Page) bool {
+		for _, o := range p.Meta.Owners {
+			if strings.EqualFold(o, owner) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func modifiedFilter(value string) (predicate, error) {
+	op := "="
+	if strings.HasPrefix(value, ">") || strings.HasPrefix(value, "<") || strings.HasPrefix(value, "=") {
+		op, value = value[:1], value[1:]
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, want YYYY-MM-DD", value)
+	}
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case ">":
+		return func(p *Page) bool { return !p.ModTime.Before(next) }, nil
+	case "<":
+		return func(p *Page) bool { return p.ModTime.Before(day) }, nil
+	}
+	return func(p *Page) bool { return !p.ModTime.Before(day) && p.ModTime.Before(next) }, nil
+}
+
+func (q pageQuery) matches(p *Page) bool {
+	for _, group := range q.groups {
+		all := true
+		for _, pred := range group {
+			if !pred(p) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAllPages loads every page with its metadata parsed and its archive
+// state set. There is no index, so this reads the whole store.
+func (s *Server) loadAllPages(ctx context.Context) ([]*Page, error) {
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	pages := make([]*Page, 0, len(titles))
+	for _, title := range titles {
+		p, err := s.store.Load(ctx, title)
+		if err != nil {
+			return nil, err
+		}
+		p.Meta, _, _ = parseFrontMatter(p.Body)
+		s.markArchived(p, now)
+		pages = append(pages, p)
+	}
+	return pages, nil
+}
+
+func (s *Server) runQuery(ctx context.Context, q pageQuery) ([]*Page, error) {
+	pages, err := s.loadAllPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pages = withoutPrivate(pages)
+	if !q.archived {
+		pages = withoutArchived(pages)
+	}
+	var results []*Page
+	for _, p := range pages {
+		if q.matches(p) {
+			results = append(results, p)
+		}
+	}
+	if q.sort == "modified" {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].ModTime.After(results[j].ModTime)
+		})
+	}
+	if q.limit > 0 && len(results) > q.limit {
+		results = results[:q.limit]
+	}
+	return results, nil
+}
+
+func (s *Server) queryBlock(ctx context.Context, args string, content []byte) (template.HTML, error) {
+	q, err := parseQuery(args + " " + string(content))
+	if err != nil {
+		return "", err
+	}
+	results, err := s.runQuery(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return `<p class="query">No matching pages.</p>`, nil
+	}
+	var b strings.Builder
+	b.WriteString(`<ul class="query">`)
+	for _, p := range results {
+		b.WriteString("<li>")
+		b.Write(htmlLink("/view/"+p.Title, p.Title))
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+	return template.HTML(b.String()), nil
+}
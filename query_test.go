@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, q := range []string{
+		"OR tag:a",
+		"tag:a OR",
+		"tag:a OR OR tag:b",
+		"OR",
+		"sort:size",
+		"limit:0",
+		"limit:x",
+		"archived:maybe",
+		"modified:>yesterday",
+		"colour:red",
+	} {
+		if _, err := parseQuery(q); err == nil {
+			t.Errorf("parseQuery(%q) succeeded, want an error", q)
+		}
+	}
+}
+
+func TestParseQueryMatches(t *testing.T) {
+	day := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	pages := []*Page{
+		{Title: "RunbookDeploy", ModTime: day, Meta: Metadata{Tags: []string{"runbook"}, Owners: []string{"ops"}}},
+		{Title: "RunbookBackup", ModTime: day.AddDate(0, 0, -5), Meta: Metadata{Tags: []string{"runbook", "db"}}},
+		{Title: "MeetingNotes", ModTime: day.AddDate(0, 0, 5), Meta: Metadata{Owners: []string{"Ops"}}},
+		{Title: "OldPlan", ModTime: day, Archived: true},
+	}
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"", "RunbookDeploy RunbookBackup MeetingNotes OldPlan"},
+		{"tag:runbook", "RunbookDeploy RunbookBackup"},
+		{"tag:RUNBOOK -tag:db", "RunbookDeploy"},
+		{"owner:ops", "RunbookDeploy MeetingNotes"},
+		{"tag:db OR title:meeting", "RunbookBackup MeetingNotes"},
+		{"runbook deploy", "RunbookDeploy"},
+		{"modified:2024-03-10", "RunbookDeploy OldPlan"},
+		{"modified:>2024-03-10", "MeetingNotes"},
+		{"modified:<2024-03-10", "RunbookBackup"},
+		{"archived:true", "OldPlan"},
+		{"-archived:true tag:runbook", "RunbookDeploy RunbookBackup"},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.q)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.q, err)
+			continue
+		}
+		var got []string
+		for _, p := range pages {
+			if q.matches(p) {
+				got = append(got, p.Title)
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%q matches %v, want %s", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryOptions(t *testing.T) {
+	q, err := parseQuery("tag:a sort:modified limit:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.sort != "modified" || q.limit != 3 || q.archived {
+		t.Errorf("got sort %q, limit %d, archived %v", q.sort, q.limit, q.archived)
+	}
+	if q, _ := parseQuery("archived:false"); !q.archived {
+		t.Error("archived:false should mark the query as choosing archived pages itself")
+	}
+}
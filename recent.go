@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	visitorCookie      = "wiki_visitor"
+	recentPerVisitor   = 20
+	maxRecentVisitors  = 1000
+	quickSwitchResults = 10
+)
+
+type recentList struct {
+	titles []string // most recent first
+	seen   time.Time
+}
+
+// recentPages remembers the pages each visitor viewed last. There are no
+// accounts, so a visitor is an anonymous cookie; the store is in memory
+// and evicts the least recently active visitor when full.
+type recentPages struct {
+	mu       sync.Mutex
+	visitors map[string]*recentList
+}
+
+func newRecentPages() *recentPages {
+	return &recentPages{visitors: map[string]*recentList{}}
+}
+
+func (rp *recentPages) Add(visitor, title string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	l, ok := rp.visitors[visitor]
+	if !ok {
+		if len(rp.visitors) >= maxRecentVisitors {
+			rp.evictOldest()
+		}
+		l = &recentList{}
+		rp.visitors[visitor] = l
+	}
+	l.seen = time.Now()
+	titles := []string{title}
+	for _, t := range l.titles {
+		if t != title && len(titles) < recentPerVisitor {
+			titles = append(titles, t)
+		}
+	}
+	l.titles = titles
+}
+
+func (rp *recentPages) Get(visitor string) []string {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if l, ok := rp.visitors[visitor]; ok {
+		return append([]string(nil), l.titles...)
+	}
+	return nil
+}
+
+func (rp *recentPages) evictOldest() {
+	var oldest string
+	var oldestSeen time.Time
+	for id, l := range rp.visitors {
+		if oldest == "" || l.seen.Before(oldestSeen) {
+			oldest, oldestSeen = id, l.seen
+		}
+	}
+	delete(rp.visitors, oldest)
+}
+
+// visitorID returns the visitor cookie's value, issuing a new cookie when the
+// request has none.
+func visitorID(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(visitorCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+type quickSwitchResult struct {
+	Title  string `json:"title"`
+	Recent bool   `json:"recent"`
+}
+
+// quickSwitch ranks fuzzy title matches and the visitor's recent pages
+// together. A recently viewed page has its distance reduced by up to one
+// point, more the more recently it was viewed, so it wins over pages that
+// match equally well. An empty query returns the recent pages alone.
+func (s *Server) quickSwitch(ctx context.Context, visitor, q string) ([]quickSwitchResult, error) {
+	recent := s.recent.Get(visitor)
+	if strings.TrimSpace(q) == "" {
+		results := []quickSwitchResult{}
+		for _, t := range recent {
+			if len(results) == quickSwitchResults {
+				break
+			}
+			results = append(results, quickSwitchResult{Title: t, Recent: true})
+		}
+		return results, nil
+	}
+
+	titles, err := s.listedTitles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recentRank := map[string]int{}
+	for i, t := range recent {
+		recentRank[t] = i
+	}
+
+	type scored struct {
+		quickSwitchResult
+		score float64
+	}
+	var matches []scored
+	for _, t := range titles {
+		d, ok := titleDistance(q, t)
+		if !ok {
+			continue
+		}
+		score := float64(d)
+		rank, isRecent := recentRank[t]
+		if isRecent {
+			score -= 1 - float64(rank)/recentPerVisitor
+		}
+		matches = append(matches, scored{quickSwitchResult{Title: t, Recent: isRecent}, score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score < matches[j].score })
+
+	results := []quickSwitchResult{}
+	for _, m := range matches {
+		if len(results) == quickSwitchResults {
+			break
+		}
+		results = append(results, m.quickSwitchResult)
+	}
+	return results, nil
+}
+
+func (s *Server) apiQuickSwitchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	results, err := s.quickSwitch(ctx, visitorID(w, r), canonical(r.URL.Query().Get("q")))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
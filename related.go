@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const relatedLimit = 5
+
+var validRelatedPath = regexp.MustCompile(`^/api/related/([\p{L}\p{N}]+)$`)
+
+type relatedPage struct {
+	Title string `json:"title"`
+	Score int    `json:"score"`
+}
+
+// pageLinks are the pages body links to. Links inside fenced blocks are
+// not rendered as links, so they do not count.
+func pageLinks(body []byte) map[string]bool {
+	links := map[string]bool{}
+	for _, seg := range splitBlocks(body) {
+		if seg.fenced {
+			continue
+		}
+		for _, m := range wikiLink.FindAllSubmatch(seg.content, -1) {
+			links[canonical(string(m[1]))] = true
+		}
+	}
+	return links
+}
+
+func tagSet(meta Metadata) map[string]bool {
+	tags := map[string]bool{}
+	for _, t := range meta.Tags {
+		tags[strings.ToLower(t)] = true
+	}
+	return tags
+}
+
+// relatedEntry is what relatedPages needs of a page. page has no body
+// and is never modified, so entries can be shared between requests.
+type relatedEntry struct {
+	page  *Page
+	links map[string]bool
+	tags  map[string]bool
+}
+
+// relatedIndex caches the links and tags of every page, so viewing a page
+// does not load the whole store. Saving any page invalidates it; gen
+// keeps a rebuild that raced with a save from being kept.
+type relatedIndex struct {
+	mu      sync.Mutex
+	entries []relatedEntry
+	fresh   bool
+	gen     int
+}
+
+func (ri *relatedIndex) invalidate() {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.fresh = false
+	ri.gen++
+}
+
+func (s *Server) relatedEntries(ctx context.Context) ([]relatedEntry, error) {
+	ri := &s.related
+	ri.mu.Lock()
+	if ri.fresh {
+		defer ri.mu.Unlock()
+		return ri.entries, nil
+	}
+	gen := ri.gen
+	ri.mu.Unlock()
+
+	pages, err := s.loadAllPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]relatedEntry, len(pages))
+	for i, p := range pages {
+		_, content, err := parseFrontMatter(p.Body)
+		if err != nil {
+			content = p.Body
+		}
+		entries[i] = relatedEntry{
+			page:  &Page{Title: p.Title, Meta: p.Meta, ModTime: p.ModTime},
+			links: pageLinks(content),
+			tags:  tagSet(p.Meta),
+		}
+	}
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if ri.gen == gen {
+		ri.entries, ri.fresh = entries, true
+	}
+	return entries, nil
+}
+
+// relatedPages scores every other page by the links and tags it shares
+// with title, with a bonus when either page links to the other.
+func (s *Server) relatedPages(ctx context.Context, title string, limit int) ([]relatedPage, error) {
+	entries, err := s.relatedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var live []relatedEntry
+	var self relatedEntry
+	found := false
+	for _, e := range entries {
+		if _, archived := s.archivedSince(e.page, now); archived {
+			continue
+		}
+		live = append(live, e)
+		if e.page.Title == title {
+			self, found = e, true
+		}
+	}
+	if !found {
+		return nil, errPageNotFound
+	}
+	links, tags := self.links, self.tags
+
+	related := []relatedPage{}
+	for _, e := range live {
+		p := e.page
+		if p.Title == title || p.Meta.private() {
+			continue
+		}
+		score := 0
+		otherLinks := e.links
+		for l := range otherLinks {
+			if links[l] && l != title && l != p.Title {
+				score++
+			}
+		}
+		for t := range e.tags {
+			if tags[t] {
+				score++
+			}
+		}
+		if links[p.Title] || otherLinks[title] {
+			score += 2
+		}
+		if score > 0 {
+			related = append(related, relatedPage{Title: p.Title, Score: score})
+		}
+	}
+	sort.SliceStable(related, func(i, j int) bool { return related[i].Score > related[j].Score })
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+// privateTitles are the pages marked visibility: private, for listings
+// that have only titles to go on.
+func (s *Server) privateTitles(ctx context.Context) (map[string]bool, error) {
+	entries, err := s.relatedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	private := map[string]bool{}
+	for _, e := range entries {
+		if e.page.Meta.private() {
+			private[e.page.Title] = true
+		}
+	}
+	return private, nil
+}
+
+// listedTitles are the titles of every page but the private ones, for
+// suggesting titles.
+func (s *Server) listedTitles(ctx context.Context) ([]string, error) {
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	private, err := s.privateTitles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var listed []string
+	for _, t := range titles {
+		if !private[t] {
+			listed = append(listed, t)
+		}
+	}
+	return listed, nil
+}
+
+func (s *Server) apiRelatedHandler(w http.ResponseWriter, r *http.Request) {
+	m := validRelatedPath.FindStringSubmatch(canonical(r.URL.Path))
+	if m == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "invalid page title"})
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	related, err := s.relatedPages(ctx, m[1], relatedLimit)
+	if errors.Is(err, errPageNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "page not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, related)
+}
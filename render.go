@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type RenderFilter func(body []byte) []byte
+
+// BlockRenderer renders a fenced ```lang block. args is the rest of the
+// opening fence line after the language name.
+type BlockRenderer func(ctx context.Context, args string, content []byte) (template.HTML, error)
+
+var wikiLink = regexp.MustCompile(`\[\[([\p{L}\p{N}]+)\]\]`)
+var externalLink = regexp.MustCompile(`\[(https?://[^\s]+)\s([^\]]+)\]`)
+
+// LinkPolicy controls the attributes put on links to other sites.
+type LinkPolicy struct {
+	Rel    string
+	Target string
+	Class  string
+	// Interstitial sends external links through the /leave confirmation
+	// page instead of linking to them directly.
+	Interstitial bool
+}
+
+type Renderer struct {
+	filters    []RenderFilter
+	blocks     map[string]BlockRenderer
+	shortcodes map[string]Shortcode
+	// bareURLs, if set, may replace a URL written alone on a line.
+	bareURLs func(ctx context.Context, rawURL string) (template.HTML, bool)
+}
+
+func newRenderer(links LinkPolicy) *Renderer {
+	r := &Renderer{
+		filters: []RenderFilter{renderWikiLinks, links.renderExternalLinks},
+		blocks: map[string]BlockRenderer{
+			"csv":     tableBlock(','),
+			"tsv":     tableBlock('\t'),
+			"gallery": galleryBlock,
+		},
+		shortcodes: map[string]Shortcode{},
+	}
+	for name, sc := range builtinShortcodes {
+		r.shortcodes[name] = sc
+	}
+	return r
+}
+
+// AddFilter appends a filter; filters run in order over the raw page body
+// before paragraphs are wrapped.
+func (r *Renderer) AddFilter(f RenderFilter) {
+	r.filters = append(r.filters, f)
+}
+
+func (r *Renderer) AddBlock(lang string, b BlockRenderer) {
+	r.blocks[lang] = b
+}
+
+func (r *Renderer) SetBareURLHandler(h func(ctx context.Context, rawURL string) (template.HTML, bool)) {
+	r.bareURLs = h
+}
+
+func (r *Renderer) Render(ctx context.Context, body []byte) template.HTML {
+	var parts []string
+	for _, seg := range splitBlocks(body) {
+		var html template.HTML
+		if seg.fenced {
+			html = r.renderBlock(ctx, seg)
+		} else {
+			html = r.renderText(ctx, seg.content)
+		}
+		if html != "" {
+			parts = append(parts, string(html))
+		}
+	}
+	return template.HTML(strings.Join(parts, "\n"))
+}
+
+func (r *Renderer) renderText(ctx context.Context, body []byte) template.HTML {
+	body, restore := r.expandShortcodes(ctx, body)
+	body = expandVariables(ctx, body)
+	for _, f := range r.filters {
+		body = f(body)
+	}
+	return wrapParagraphs(template.HTML(restore(body)))
+}
+
+func (r *Renderer) renderBlock(ctx context.Context, seg segment) template.HTML {
+	b, ok := r.blocks[seg.lang]
+	if !ok {
+		return template.HTML("<pre><code>" + template.HTMLEscapeString(string(seg.content)) + "</code></pre>")
+	}
+	html, err := b(ctx, seg.args, seg.content)
+	if err != nil {
+		return template.HTML("<p class=\"block-error\">" + template.HTMLEscapeString(seg.lang+": "+err.Error()) + "</p>")
+	}
+	return html
+}
+
+type segment struct {
+	fenced  bool
+	lang    string
+	args    string
+	content []byte
+	// line is where the segment starts in the body, counting from 1; the
+	// content of a multi-line fence starts on the line after.
+	line int
+}
+
+var fence = "```"
+
+// splitBlocks separates fenced blocks from running text. A fence may span
+// several lines, or sit on one line as ```lang args```. An unterminated
+// fence runs to the end of the body.
+func splitBlocks(body []byte) []segment {
+	var segs []segment
+	var text []string
+	textLine := 0
+	flushText := func() {
+		if len(text) > 0 {
+			segs = append(segs, segment{content: []byte(strings.Join(text, "\n")), line: textLine})
+			text = nil
+		}
+	}
+
+	lines := strings.Split(string(body), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, fence) {
+			if len(text) == 0 {
+				textLine = i + 1
+			}
+			text = append(text, lines[i])
+			continue
+		}
+		flushText()
+
+		header := strings.TrimPrefix(line, fence)
+		oneLine := len(header) > len(fence) && strings.HasSuffix(header, fence)
+		if oneLine {
+			header = strings.TrimSuffix(header, fence)
+		}
+		lang, args, _ := strings.Cut(strings.TrimSpace(header), " ")
+		seg := segment{fenced: true, lang: lang, args: strings.TrimSpace(args), line: i + 1}
+		if !oneLine {
+			var content []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != fence; i++ {
+				content = append(content, lines[i])
+			}
+			seg.content = []byte(strings.Join(content, "\n"))
+		}
+		segs = append(segs, seg)
+	}
+	flushText()
+	return segs
+}
+
+func htmlLink(href string, text string) []byte {
+	return []byte("<a href=\"" + href + "\">" + text + "</a>")
+}
+
+func wikiLinkToHTML(link []byte) []byte {
+	matches := wikiLink.FindSubmatch(link)
+	if matches == nil {
+		return link
+	}
+	linkText := canonical(string(matches[1]))
+	return []byte("<a href=\"/view/" + linkText + "\" class=\"wiki-link\" data-preview=\"/api/preview/" + linkText + "\">" + linkText + "</a>")
+}
+
+func (lp LinkPolicy) externalLinkToHTML(link []byte) []byte {
+	matches := externalLink.FindSubmatch(link)
+	if matches == nil {
+		return link
+	}
+	linkHref := string(matches[1])
+	linkText := string(matches[2])
+	if lp.Interstitial {
+		linkHref = "/leave?url=" + url.QueryEscape(linkHref)
+	}
+	var b strings.Builder
+	b.WriteString(`<a href="` + template.HTMLEscapeString(linkHref) + `"`)
+	if lp.Class != "" {
+		b.WriteString(` class="` + template.HTMLEscapeString(lp.Class) + `"`)
+	}
+	if lp.Rel != "" {
+		b.WriteString(` rel="` + template.HTMLEscapeString(lp.Rel) + `"`)
+	}
+	if lp.Target != "" {
+		b.WriteString(` target="` + template.HTMLEscapeString(lp.Target) + `"`)
+	}
+	b.WriteString(">" + linkText + "</a>")
+	return []byte(b.String())
+}
+
+func renderWikiLinks(body []byte) []byte {
+	return wikiLink.ReplaceAllFunc(body, wikiLinkToHTML)
+}
+
+func (lp LinkPolicy) renderExternalLinks(body []byte) []byte {
+	return externalLink.ReplaceAllFunc(body, lp.externalLinkToHTML)
+}
+
+func wrapParagraphs(body template.HTML) template.HTML {
+	lines := strings.Split(string(body), "\n")
+	var paragraphs []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			paragraphs = append(paragraphs, "<p>"+line+"</p>")
+		}
+	}
+	return template.HTML(strings.Join(paragraphs, "\n"))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []segment
+	}{
+		{"text only", "a\nb", []segment{{content: []byte("a\nb"), line: 1}}},
+		{"fence", "a\n```csv noheader\nx,y\n```\nb", []segment{
+			{content: []byte("a"), line: 1},
+			{fenced: true, lang: "csv", args: "noheader", content: []byte("x,y"), line: 2},
+			{content: []byte("b"), line: 5},
+		}},
+		{"one-line fence", "```query tag:x```\nafter", []segment{
+			{fenced: true, lang: "query", args: "tag:x", line: 1},
+			{content: []byte("after"), line: 2},
+		}},
+		{"one-line fence then fence", "```query tag:x```\n```\ncode\n```\nend", []segment{
+			{fenced: true, lang: "query", args: "tag:x", line: 1},
+			{fenced: true, content: []byte("code"), line: 2},
+			{content: []byte("end"), line: 5},
+		}},
+		{"unterminated fence", "a\n```\nb\nc", []segment{
+			{content: []byte("a"), line: 1},
+			{fenced: true, content: []byte("b\nc"), line: 2},
+		}},
+	}
+	for _, tt := range tests {
+		got := splitBlocks([]byte(tt.body))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: splitBlocks(%q) = %+v, want %+v", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type reviewItem struct {
+	Title       string
+	Due         string
+	DaysOverdue int
+	Owners      []string
+}
+
+type reviewQueue struct {
+	mu      sync.RWMutex
+	items   []reviewItem
+	checked time.Time
+}
+
+// parseReviewInterval reads intervals like 30d, 2w, 6m or 1y.
+func parseReviewInterval(s string) (days, months int, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("invalid review interval %q, want e.g. 30d, 2w, 6m or 1y", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("invalid review interval %q, want e.g. 30d, 2w, 6m or 1y", s)
+	}
+	switch s[len(s)-1] {
+	case 'd':
+		return n, 0, nil
+	case 'w':
+		return 7 * n, 0, nil
+	case 'm':
+		return 0, n, nil
+	case 'y':
+		return 0, 12 * n, nil
+	}
+	return 0, 0, fmt.Errorf("invalid review interval %q, want e.g. 30d, 2w, 6m or 1y", s)
+}
+
+// reviewDue returns when p next needs a review: its interval after the
+// reviewed: date, or after the last edit when it was never marked
+// reviewed. ok is false for pages without a review interval.
+func reviewDue(p *Page) (due time.Time, ok bool) {
+	if p.Meta.Review == "" {
+		return time.Time{}, false
+	}
+	days, months, err := parseReviewInterval(p.Meta.Review)
+	if err != nil {
+		return time.Time{}, false
+	}
+	last := p.ModTime
+	if p.Meta.Reviewed != "" {
+		if reviewed, err := time.ParseInLocation(dateLayout, p.Meta.Reviewed, time.Local); err == nil {
+			last = reviewed
+		}
+	}
+	if last.IsZero() {
+		return time.Time{}, false
+	}
+	return last.AddDate(0, months, days), true
+}
+
+func validateReview(ctx context.Context, p *Page) error {
+	meta, _, err := parseFrontMatter(p.Body)
+	if err != nil {
+		return nil
+	}
+	if meta.Review != "" {
+		if _, _, err := parseReviewInterval(meta.Review); err != nil {
+			return err
+		}
+	}
+	if meta.Reviewed != "" {
+		if _, err := time.Parse(dateLayout, meta.Reviewed); err != nil {
+			return fmt.Errorf("reviewed must be a date like 2024-12-31, not %q", meta.Reviewed)
+		}
+	}
+	return nil
+}
+
+func (s *Server) checkReviews(ctx context.Context) error {
+	pages, err := s.loadAllPages(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var items []reviewItem
+	for _, p := range withoutArchived(pages) {
+		due, ok := reviewDue(p)
+		if !ok || now.Before(due) {
+			continue
+		}
+		items = append(items, reviewItem{
+			Title:       p.Title,
+			Due:         due.Format(dateLayout),
+			DaysOverdue: int(now.Sub(due).Hours() / 24),
+			Owners:      p.Meta.Owners,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DaysOverdue > items[j].DaysOverdue })
+
+	s.reviews.mu.Lock()
+	s.reviews.items, s.reviews.checked = items, now
+	s.reviews.mu.Unlock()
+	return nil
+}
+
+// RunReviewJob refreshes the review queue immediately and then every
+// interval until ctx is cancelled. A non-positive interval checks once.
+func (s *Server) RunReviewJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		if err := s.checkReviews(ctx); err != nil {
+			log.Printf("review check: %v", err)
+		}
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.checkReviews(ctx); err != nil {
+			log.Printf("review check: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) reviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		ctx, cancel := s.storeContext(r)
+		defer cancel()
+		if err := s.checkReviews(ctx); err != nil {
+			storeError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/admin/review", http.StatusFound)
+		return
+	}
+
+	data := struct {
+		Items   []reviewItem
+		Checked string
+		Owner   string
+	}{Owner: canonical(r.URL.Query().Get("owner"))}
+	s.reviews.mu.RLock()
+	for _, item := range s.reviews.items {
+		if data.Owner == "" || hasOwner(data.Owner)(&Page{Meta: Metadata{Owners: item.Owners}}) {
+			data.Items = append(data.Items, item)
+		}
+	}
+	if !s.reviews.checked.IsZero() {
+		data.Checked = s.reviews.checked.Format("2006-01-02 15:04")
+	}
+	s.reviews.mu.RUnlock()
+	s.renderTemplate(w, "review", data)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var validEditorPath = regexp.MustCompile(`^/api/editor/([\p{L}\p{N}]+)$`)
+
+// editorHTML renders page text for a rich-text editor. Unlike the view
+// renderer it is meant to come back through convertHTML unchanged: fenced
+// blocks stay as <pre> with their language instead of being run, and
+// "- " lines become a list.
+func editorHTML(content []byte) string {
+	var b strings.Builder
+	for _, seg := range splitBlocks(content) {
+		if seg.fenced {
+			b.WriteString(`<pre data-lang="` + template.HTMLEscapeString(seg.lang) + `"`)
+			if seg.args != "" {
+				b.WriteString(` data-args="` + template.HTMLEscapeString(seg.args) + `"`)
+			}
+			b.WriteString(">" + template.HTMLEscapeString(string(seg.content)) + "</pre>\n")
+			continue
+		}
+		inList := false
+		for _, line := range strings.Split(string(seg.content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			item, isItem := strings.CutPrefix(line, "- ")
+			if isItem != inList {
+				if isItem {
+					b.WriteString("<ul>\n")
+				} else {
+					b.WriteString("</ul>\n")
+				}
+				inList = isItem
+			}
+			if isItem {
+				b.WriteString("<li>" + editorLine(item) + "</li>\n")
+			} else {
+				b.WriteString("<p>" + editorLine(line) + "</p>\n")
+			}
+		}
+		if inList {
+			b.WriteString("</ul>\n")
+		}
+	}
+	return b.String()
+}
+
+// editorLine escapes a line of text and turns its links into anchors.
+func editorLine(line string) string {
+	type span struct {
+		start, end int
+		html       string
+	}
+	var spans []span
+	for _, m := range wikiLink.FindAllStringSubmatchIndex(line, -1) {
+		title := template.HTMLEscapeString(canonical(line[m[2]:m[3]]))
+		spans = append(spans, span{m[0], m[1], `<a href="/view/` + title + `">` + title + `</a>`})
+	}
+	for _, m := range externalLink.FindAllStringSubmatchIndex(line, -1) {
+		spans = append(spans, span{m[0], m[1], `<a href="` + template.HTMLEscapeString(line[m[2]:m[3]]) + `">` +
+			template.HTMLEscapeString(line[m[4]:m[5]]) + `</a>`})
+	}
+	var b strings.Builder
+	last := 0
+	for len(spans) > 0 {
+		next := 0
+		for i, sp := range spans {
+			if sp.start < spans[next].start {
+				next = i
+			}
+		}
+		sp := spans[next]
+		spans = append(spans[:next], spans[next+1:]...)
+		if sp.start < last {
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(line[last:sp.start]) + sp.html)
+		last = sp.end
+	}
+	b.WriteString(template.HTMLEscapeString(line[last:]))
+	return b.String()
+}
+
+type editorPage struct {
+	Title string `json:"title"`
+	// FrontMatter is the raw front matter block, which the editor should
+	// send back untouched in the frontmatter field.
+	FrontMatter string `json:"frontmatter"`
+	HTML        string `json:"html"`
+	Base        string `json:"base"`
+}
+
+// apiEditorHandler returns a page as editor HTML. Saving the edited HTML
+// back goes through /save/ with format=html.
+func (s *Server) apiEditorHandler(w http.ResponseWriter, r *http.Request) {
+	m := validEditorPath.FindStringSubmatch(canonical(r.URL.Path))
+	if m == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "invalid page title"})
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	p, err := s.store.Load(ctx, m[1])
+	if errors.Is(err, errPageNotFound) {
+		p = &Page{Title: m[1]}
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	_, content, err := parseFrontMatter(p.Body)
+	if err != nil {
+		content = p.Body
+	}
+	writeJSON(w, http.StatusOK, editorPage{
+		Title:       p.Title,
+		FrontMatter: string(p.Body[:len(p.Body)-len(content)]),
+		HTML:        editorHTML(content),
+		Base:        bodyVersion(p),
+	})
+}
+
+// submittedBody returns the page source from a save form. Rich-text
+// editors post format=html with the edited HTML as body and the page's
+// front matter alongside; that HTML is converted back to wiki source, so
+// nothing but wiki markup is ever stored.
+func (s *Server) submittedBody(r *http.Request) (string, error) {
+	body := r.FormValue("body")
+	if r.FormValue("format") != "html" {
+		return canonical(body), nil
+	}
+	source, err := convertHTML(strings.NewReader(body), s.baseURL(r))
+	if err != nil {
+		return "", err
+	}
+	front := r.FormValue("frontmatter")
+	if front != "" && !strings.HasSuffix(front, "\n") {
+		front += "\n"
+	}
+	return canonical(front + source), nil
+}
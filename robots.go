@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// robotsDisallowed lists the routes that are never worth crawling: editors,
+// actions that change pages and machine endpoints.
+var robotsDisallowed = []string{"/edit/", "/save/", "/copy/", "/stub/", "/admin/", "/api/", "/go", "/leave", "/today", "/webmention"}
+
+func (s *Server) robotsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.config.RobotsFile != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeFile(w, r, s.config.RobotsFile)
+		return
+	}
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if s.config.NoIndex {
+		b.WriteString("Disallow: /\n")
+	} else {
+		for _, path := range robotsDisallowed {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// noIndex reports whether p should carry a robots noindex tag: the whole
+// wiki is hidden, the page asks for it, or its title matches the
+// noindex_titles setting.
+func (s *Server) noIndex(p *Page) bool {
+	if s.config.NoIndex || p.Meta.NoIndex || p.Meta.private() {
+		return true
+	}
+	patterns, _ := compilePatterns(s.settings.Get("noindex_titles"))
+	for _, re := range patterns {
+		if re.MatchString(p.Title) {
+			return true
+		}
+	}
+	return false
+}
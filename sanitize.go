@@ -0,0 +1,148 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sanitizeTags are the elements the renderer, blocks and shortcodes
+// produce, and plain formatting a page may write as HTML. Other elements
+// are dropped but keep their text, except droppedTags, whose content goes
+// too.
+var sanitizeTags = map[atom.Atom]bool{
+	atom.P: true, atom.A: true, atom.Abbr: true, atom.Code: true, atom.Pre: true, atom.Kbd: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Div: true, atom.Span: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Iframe: true, atom.Img: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true,
+	atom.Table: true, atom.Thead: true, atom.Tbody: true, atom.Tr: true, atom.Th: true, atom.Td: true,
+	atom.Strong: true, atom.Em: true, atom.B: true, atom.I: true, atom.Br: true, atom.Hr: true,
+	atom.Blockquote: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Sup: true, atom.Sub: true, atom.Small: true, atom.S: true, atom.Del: true, atom.Ins: true,
+	atom.Mark: true, atom.Q: true, atom.Cite: true, atom.U: true, atom.Caption: true,
+}
+
+var droppedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Template: true, atom.Textarea: true,
+	atom.Object: true, atom.Embed: true, atom.Noscript: true, atom.Select: true,
+}
+
+// styleProperties are the CSS properties galleries, tables and video
+// frames set. Other declarations are removed from style attributes.
+var styleProperties = map[string]bool{
+	"display": true, "grid-template-columns": true, "gap": true, "margin": true, "width": true,
+	"max-width": true, "aspect-ratio": true, "object-fit": true, "border": true, "text-align": true,
+}
+
+var styleValue = regexp.MustCompile(`^[a-z0-9 .%/,()-]+$`)
+
+var sanitizeAttrs = map[string]bool{
+	"class": true, "title": true, "style": true, "alt": true, "width": true, "height": true,
+	"loading": true, "rel": true, "target": true, "allowfullscreen": true, "allow": true,
+	"referrerpolicy": true, "data-preview": true, "data-lightbox": true, "data-caption": true,
+	"href": true, "src": true,
+}
+
+// sanitizeHTML keeps only the markup the wiki itself renders: known
+// elements and attributes, links and sources that are http(s) or relative
+// to the wiki, and iframes on the https hosts frameHost accepts. Page text
+// is raw HTML, so this is what stops a page from carrying forms, scripts,
+// event handlers or frames of other sites.
+func sanitizeHTML(fragment string, frameHost func(host string) bool) string {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return template.HTMLEscapeString(fragment)
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		sanitizeNode(&b, n, frameHost)
+	}
+	return b.String()
+}
+
+func sanitizeNode(b *strings.Builder, n *html.Node, frameHost func(string) bool) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if droppedTags[n.DataAtom] {
+		return
+	}
+	if n.DataAtom == atom.Iframe {
+		u, err := url.Parse(attr(n, "src"))
+		if err != nil || u.Scheme != "https" || !frameHost(u.Hostname()) {
+			return
+		}
+	}
+	keep := sanitizeTags[n.DataAtom]
+	if keep {
+		b.WriteString("<" + n.Data)
+		for _, a := range n.Attr {
+			if a.Namespace != "" || !sanitizeAttrs[a.Key] {
+				continue
+			}
+			if (a.Key == "href" || a.Key == "src") && !safeURL(a.Val) {
+				continue
+			}
+			if a.Key == "style" {
+				if a.Val = safeStyle(a.Val); a.Val == "" {
+					continue
+				}
+			}
+			b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+		}
+		b.WriteString(">")
+		if n.DataAtom == atom.Img || n.DataAtom == atom.Br || n.DataAtom == atom.Hr {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sanitizeNode(b, c, frameHost)
+	}
+	if keep {
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+// safeURL allows http(s) URLs and paths on the wiki itself.
+func safeURL(s string) bool {
+	if _, ok := httpURL(s); ok {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "" && u.Host == "" && !strings.HasPrefix(s, "//")
+}
+
+// safeStyle keeps the declarations of style whose property is one the
+// wiki sets and whose value is plain sizes, keywords and functions such
+// as repeat(), with no url().
+func safeStyle(style string) string {
+	var kept []string
+	for _, decl := range strings.Split(style, ";") {
+		prop, value, ok := strings.Cut(decl, ":")
+		prop, value = strings.ToLower(strings.TrimSpace(prop)), strings.ToLower(strings.TrimSpace(value))
+		if ok && styleProperties[prop] && styleValue.MatchString(value) && !strings.Contains(value, "url") && !strings.Contains(value, "expression") {
+			kept = append(kept, prop+": "+value)
+		}
+	}
+	return strings.Join(kept, "; ")
+}
+
+// frameHost reports whether iframes from host may appear on pages: the
+// video hosts of the default frame-src, and the -embed-hosts.
+func (s *Server) frameHost(host string) bool {
+	for _, src := range strings.Fields(videoFrameSources) {
+		if strings.EqualFold(strings.TrimPrefix(src, "https://"), host) {
+			return true
+		}
+	}
+	return s.embeds != nil && s.embeds.allowed(host)
+}
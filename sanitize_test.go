@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"text", `a < b & c`, `a &lt; b &amp; c`},
+		{"wiki markup", `<p><a href="/view/Home" class="wiki-link">Home</a></p>`, `<p><a href="/view/Home" class="wiki-link">Home</a></p>`},
+		{"script", `<p>hi<script>alert(1)</script></p>`, `<p>hi</p>`},
+		{"form keeps text", `<form action="https://evil.example">Log in<input name="pw"></form>`, `Log in`},
+		{"event handler", `<img src="/x.png" onerror="alert(1)">`, `<img src="/x.png">`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"protocol-relative link", `<a href="//evil.example/">x</a>`, `<a>x</a>`},
+		{"https link", `<a href="https://example.com/?a=1&amp;b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"video iframe", `<iframe src="https://player.vimeo.com/video/1"></iframe>`, `<iframe src="https://player.vimeo.com/video/1"></iframe>`},
+		{"iframe elsewhere", `<iframe src="https://evil.example/"></iframe>`, ``},
+		{"plain http iframe", `<iframe src="http://player.vimeo.com/video/1"></iframe>`, ``},
+		{"style kept", `<table><tbody><tr><td style="text-align: right">1</td></tr></tbody></table>`, `<table><tbody><tr><td style="text-align: right">1</td></tr></tbody></table>`},
+		{"style filtered", `<div style="position: fixed; width: 100%; background: url(x)">x</div>`, `<div style="width: 100%">x</div>`},
+		{"style dropped", `<div style="position: fixed">x</div>`, `<div>x</div>`},
+		{"heading", `<h2>Title</h2>`, `<h2>Title</h2>`},
+		{"textarea content dropped", `<textarea>secret</textarea>`, ``},
+		{"unknown tag keeps text", `<marquee>hi</marquee>`, `hi`},
+	}
+	for _, tt := range tests {
+		if got := sanitizeHTML(tt.in, s.frameHost); got != tt.want {
+			t.Errorf("%s: sanitizeHTML(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretPattern matches a likely credential. When the expression has a
+// capture group only the group is masked, so "password: hunter2" keeps
+// its label.
+type secretPattern struct {
+	Kind string
+	re   *regexp.Regexp
+}
+
+var builtinSecretPatterns = []secretPattern{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"password or token", regexp.MustCompile(`(?i)\b(?:password|passwd|secret|api[_-]?key|access[_-]?token)\s*[:=]\s*["']?([^\s"']{6,})`)},
+}
+
+const redacted = "[redacted]"
+
+type secretFinding struct {
+	Title string
+	Line  int
+	Kind  string
+}
+
+// loadSecretPatterns adds the expressions in path, one per line, to the
+// built-in patterns. Blank lines and lines starting with # are skipped.
+func loadSecretPatterns(path string) ([]secretPattern, error) {
+	patterns := append([]secretPattern(nil), builtinSecretPatterns...)
+	if path == "" {
+		return patterns, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		patterns = append(patterns, secretPattern{Kind: "custom pattern", re: re})
+	}
+	return patterns, sc.Err()
+}
+
+// secretSpan returns the part of match m that should be masked.
+func secretSpan(m []int) (start, end int) {
+	if len(m) >= 4 && m[2] >= 0 {
+		return m[2], m[3]
+	}
+	return m[0], m[1]
+}
+
+// redactSecrets masks every match of the patterns in body.
+func redactSecrets(patterns []secretPattern, body []byte) []byte {
+	for _, p := range patterns {
+		matches := p.re.FindAllSubmatchIndex(body, -1)
+		if matches == nil {
+			continue
+		}
+		var b bytes.Buffer
+		last := 0
+		for _, m := range matches {
+			start, end := secretSpan(m)
+			b.Write(body[last:start])
+			b.WriteString(redacted)
+			last = end
+		}
+		b.Write(body[last:])
+		body = b.Bytes()
+	}
+	return body
+}
+
+func findSecrets(patterns []secretPattern, title string, body []byte) []secretFinding {
+	var findings []secretFinding
+	for _, p := range patterns {
+		for _, m := range p.re.FindAllSubmatchIndex(body, -1) {
+			start, _ := secretSpan(m)
+			findings = append(findings, secretFinding{
+				Title: title,
+				Line:  bytes.Count(body[:start], []byte("\n")) + 1,
+				Kind:  p.Kind,
+			})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// redact masks likely secrets in text that is about to be shown, unless
+// redaction is turned off.
+func (s *Server) redact(body []byte) []byte {
+	if !s.config.RedactSecrets {
+		return body
+	}
+	return redactSecrets(s.secrets, body)
+}
+
+func (s *Server) secretsReport(ctx context.Context) ([]secretFinding, error) {
+	pages, err := s.loadAllPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var findings []secretFinding
+	for _, p := range pages {
+		findings = append(findings, findSecrets(s.secrets, p.Title, p.Body)...)
+	}
+	return findings, nil
+}
+
+func (s *Server) secretsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	findings, err := s.secretsReport(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderTemplate(w, "secrets", findings)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type settingType int
+
+const (
+	settingText settingType = iota
+	settingTitle
+	settingOptionalTitle
+	settingDateTitle
+	settingPatterns
+	settingDays
+)
+
+type settingDef struct {
+	Key     string
+	Label   string
+	Type    settingType
+	Default string
+}
+
+var settingDefs = []settingDef{
+	{Key: "site_name", Label: "Site name", Type: settingText, Default: "Wiki"},
+	{Key: "default_page", Label: "Default page", Type: settingTitle, Default: "FrontPage"},
+	{Key: "journal_format", Label: "Journal title format", Type: settingDateTitle, Default: "Journal20060102"},
+	{Key: "journal_template", Label: "Journal template page", Type: settingOptionalTitle},
+	{Key: "variables_page", Label: "Site variables page", Type: settingOptionalTitle},
+	{Key: "reserved_titles", Label: "Reserved title patterns", Type: settingPatterns,
+		Default: "admin.*, all, api, copy, edit, export, go, journal, leave, save, stub, tasks, today, view, webmention"},
+	{Key: "noindex_titles", Label: "Titles hidden from search engines (patterns)", Type: settingPatterns},
+	{Key: "archive_after_days", Label: "Days without edits before a page is archived (0 for never)", Type: settingDays, Default: "0"},
+}
+
+func (d settingDef) validate(value string) error {
+	switch d.Type {
+	case settingText:
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%s cannot be empty", d.Label)
+		}
+	case settingTitle:
+		if !validTitle.MatchString(value) {
+			return fmt.Errorf("%s must be a valid page title", d.Label)
+		}
+	case settingOptionalTitle:
+		if value != "" && !validTitle.MatchString(value) {
+			return fmt.Errorf("%s must be empty or a valid page title", d.Label)
+		}
+	case settingDateTitle:
+		// The layout must identify a single day and produce a valid title,
+		// otherwise journal pages could not be told apart or found again.
+		day := time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)
+		title := day.Format(value)
+		parsed, err := time.Parse(value, title)
+		if !validTitle.MatchString(title) || err != nil || !parsed.Equal(day) {
+			return fmt.Errorf("%s must be a Go date layout such as Journal20060102 that yields a valid title", d.Label)
+		}
+	case settingDays:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a whole number of days", d.Label)
+		}
+	case settingPatterns:
+		if _, err := compilePatterns(value); err != nil {
+			return fmt.Errorf("%s: %v", d.Label, err)
+		}
+	}
+	return nil
+}
+
+// compilePatterns turns a comma-separated list of regular expressions into
+// case-insensitive matchers for whole titles.
+func compilePatterns(list string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(`(?i)^(?:` + p + `)$`)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+func lookupSetting(key string) (settingDef, bool) {
+	for _, d := range settingDefs {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return settingDef{}, false
+}
+
+type Settings struct {
+	mu     sync.RWMutex
+	path   string
+	values map[string]string
+}
+
+// loadSettings reads settings from path. An empty path keeps settings in
+// memory only, for ephemeral wikis.
+func loadSettings(path string) (*Settings, error) {
+	s := &Settings{path: path, values: map[string]string{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Settings) Get(key string) string {
+	s.mu.RLock()
+	v, ok := s.values[key]
+	s.mu.RUnlock()
+	if ok {
+		return v
+	}
+	d, _ := lookupSetting(key)
+	return d.Default
+}
+
+// Set validates every value before changing anything, so a bad form
+// submission leaves the current settings untouched.
+func (s *Settings) Set(values map[string]string) error {
+	for key, value := range values {
+		d, ok := lookupSetting(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if err := d.validate(value); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]string, len(s.values)+len(values))
+	for k, v := range s.values {
+		next[k] = v
+	}
+	for k, v := range values {
+		next[k] = v
+	}
+	if s.path != "" {
+		data, err := json.MarshalIndent(next, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(s.path, data, 0600, true); err != nil {
+			return err
+		}
+	}
+	s.values = next
+	return nil
+}
+
+type settingsField struct {
+	settingDef
+	Value string
+}
+
+type settingsData struct {
+	Fields []settingsField
+	Error  string
+	Saved  bool
+}
+
+func (s *Server) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	data := settingsData{}
+	if r.Method == http.MethodPost {
+		if !parseForm(w, r) {
+			return
+		}
+		values := map[string]string{}
+		for _, d := range settingDefs {
+			values[d.Key] = canonical(r.FormValue(d.Key))
+		}
+		if err := s.settings.Set(values); err != nil {
+			data.Error = err.Error()
+		} else {
+			data.Saved = true
+		}
+	}
+	for _, d := range settingDefs {
+		value := s.settings.Get(d.Key)
+		if data.Error != "" {
+			value = r.FormValue(d.Key)
+		}
+		data.Fields = append(data.Fields, settingsField{settingDef: d, Value: value})
+	}
+	s.renderTemplate(w, "settings", data)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Shortcode renders {{< name args >}} in running text. Positional
+// arguments are in args and key=value arguments in named.
+type Shortcode func(ctx context.Context, args []string, named map[string]string) (template.HTML, error)
+
+// shortcodePattern matches {{< name args >}}, and {{</* name args */>}},
+// which is kept as literal text with the comment markers removed.
+var shortcodePattern = regexp.MustCompile(`\{\{<(/\*)?\s*([a-z][a-z0-9_-]*)((?:\s(?:"(?:[^"\\]|\\.)*"|[^">])*?)?)\s*(\*/)?>\}\}`)
+
+func (r *Renderer) AddShortcode(name string, sc Shortcode) {
+	r.shortcodes[name] = sc
+}
+
+var builtinShortcodes = map[string]Shortcode{
+	"kbd":     kbdShortcode,
+	"abbr":    abbrShortcode,
+	"youtube": youtubeShortcode,
+	"vimeo":   vimeoShortcode,
+}
+
+// kbdShortcode shows a key combination: {{< kbd Ctrl C >}}.
+func kbdShortcode(ctx context.Context, args []string, named map[string]string) (template.HTML, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("no keys given")
+	}
+	keys := make([]string, len(args))
+	for i, k := range args {
+		keys[i] = "<kbd>" + template.HTMLEscapeString(k) + "</kbd>"
+	}
+	return template.HTML(strings.Join(keys, "+")), nil
+}
+
+// abbrShortcode explains an abbreviation: {{< abbr SLA title="service level agreement" >}}.
+func abbrShortcode(ctx context.Context, args []string, named map[string]string) (template.HTML, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("want one abbreviation, got %d", len(args))
+	}
+	return template.HTML(`<abbr title="` + template.HTMLEscapeString(named["title"]) + `">` + template.HTMLEscapeString(args[0]) + `</abbr>`), nil
+}
+
+// parseShortcodeArgs splits the text after a shortcode's name into
+// positional and key=value arguments. Values may be double-quoted to hold
+// spaces, with Go string escapes.
+func parseShortcodeArgs(s string) ([]string, map[string]string, error) {
+	var args []string
+	named := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key := ""
+		if i := strings.IndexAny(s, "= \t\""); i > 0 && s[i] == '=' && shortcodeName.MatchString(s[:i]) {
+			key, s = s[:i], s[i+1:]
+		}
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unterminated quote")
+			}
+			value, _ = strconv.Unquote(quoted)
+			s = s[len(quoted):]
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		if key != "" {
+			named[key] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+	return args, named, nil
+}
+
+// expandShortcodes replaces the shortcodes in text, and the URLs on lines
+// of their own that the bare URL handler takes, with placeholders so the
+// other filters cannot touch their HTML. It returns a function that puts
+// the rendered HTML back.
+func (r *Renderer) expandShortcodes(ctx context.Context, body []byte) ([]byte, func([]byte) []byte) {
+	// The placeholders are NUL-delimited; NUL has no place in page text,
+	// so dropping it keeps a body from forging one.
+	body = bytes.ReplaceAll(body, []byte{0}, nil)
+	var rendered [][]byte
+	hold := func(html template.HTML) []byte {
+		rendered = append(rendered, []byte(html))
+		return []byte("\x00" + strconv.Itoa(len(rendered)-1) + "\x00")
+	}
+	body = shortcodePattern.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := shortcodePattern.FindSubmatch(m)
+		name := string(sub[2])
+		var html template.HTML
+		if len(sub[1]) > 0 && len(sub[4]) > 0 {
+			html = template.HTML(template.HTMLEscapeString("{{< " + name + string(sub[3]) + " >}}"))
+		} else if sc, ok := r.shortcodes[name]; !ok {
+			html = shortcodeError(name, fmt.Errorf("unknown shortcode"))
+		} else if args, named, err := parseShortcodeArgs(string(sub[3])); err != nil {
+			html = shortcodeError(name, err)
+		} else if html, err = sc(ctx, args, named); err != nil {
+			html = shortcodeError(name, err)
+		}
+		return hold(html)
+	})
+	if r.bareURLs != nil {
+		body = bareURLLine.ReplaceAllFunc(body, func(m []byte) []byte {
+			if html, ok := r.bareURLs(ctx, string(bytes.TrimSpace(m))); ok {
+				return hold(html)
+			}
+			return m
+		})
+	}
+	if len(rendered) == 0 {
+		return body, func(b []byte) []byte { return b }
+	}
+	return body, func(b []byte) []byte {
+		return shortcodePlaceholder.ReplaceAllFunc(b, func(m []byte) []byte {
+			i, err := strconv.Atoi(string(m[1 : len(m)-1]))
+			if err != nil || i >= len(rendered) {
+				return m
+			}
+			return rendered[i]
+		})
+	}
+}
+
+// bareURLLine matches a line holding nothing but a URL.
+var bareURLLine = regexp.MustCompile(`(?m)^[ \t]*https?://[^\s"<>]+[ \t]*$`)
+
+var shortcodePlaceholder = regexp.MustCompile("\x00[0-9]+\x00")
+
+func shortcodeError(name string, err error) template.HTML {
+	return template.HTML(`<span class="shortcode-error">` + template.HTMLEscapeString(name+": "+err.Error()) + `</span>`)
+}
+
+// loadShortcodes reads custom shortcodes from a JSON object mapping names
+// to html/template sources. Templates get .Args and .Named; html/template
+// escapes them for where they appear.
+func loadShortcodes(path string) (map[string]Shortcode, error) {
+	shortcodes := map[string]Shortcode{}
+	if path == "" {
+		return shortcodes, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sources map[string]string
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, src := range sources {
+		if !shortcodeName.MatchString(name) {
+			return nil, fmt.Errorf("%s: invalid shortcode name %q", path, name)
+		}
+		t, err := template.New(name).Option("missingkey=zero").Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		shortcodes[name] = func(ctx context.Context, args []string, named map[string]string) (template.HTML, error) {
+			var b strings.Builder
+			err := t.Execute(&b, struct {
+				Args  []string
+				Named map[string]string
+			}{args, named})
+			return template.HTML(b.String()), err
+		}
+	}
+	return shortcodes, nil
+}
+
+var shortcodeName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestShortcodes(t *testing.T) {
+	r := newRenderer(LinkPolicy{})
+	tests := []struct {
+		name, in, want string
+	}{
+		{"kbd", `{{< kbd Ctrl C >}}`, `<kbd>Ctrl</kbd>+<kbd>C</kbd>`},
+		{"quoted named argument", `{{< abbr SLA title="service level agreement" >}}`, `<abbr title="service level agreement">SLA</abbr>`},
+		{"escaped arguments", `{{< kbd "<b>" >}}`, `<kbd>&lt;b&gt;</kbd>`},
+		{"unknown", `{{< nope >}}`, `<span class="shortcode-error">nope: unknown shortcode</span>`},
+		{"bad arguments", `{{< abbr >}}`, `<span class="shortcode-error">abbr: want one abbreviation, got 0</span>`},
+		{"commented out", `{{</* kbd Ctrl */>}}`, `{{&lt; kbd Ctrl &gt;}}`},
+		{"youtube", `{{< youtube dQw4w9WgXcQ >}}`, `src="https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ"`},
+		{"forged placeholder", "a\x000\x00b {{< kbd X >}}", `a0b <kbd>X</kbd>`},
+		{"forged placeholder out of range", "\x005\x00 {{< kbd X >}}", `5 <kbd>X</kbd>`},
+	}
+	for _, tt := range tests {
+		got := string(r.Render(context.Background(), []byte(tt.in)))
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("%s: Render(%q) = %q, want it to contain %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseShortcodeArgs(t *testing.T) {
+	args, named, err := parseShortcodeArgs(` one "two words" key=value q="a \"b\""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, "|") != "one|two words" || named["key"] != "value" || named["q"] != `a "b"` {
+		t.Errorf("got args %q, named %q", args, named)
+	}
+	if _, _, err := parseShortcodeArgs(`"open`); err == nil {
+		t.Error("an unterminated quote should be an error")
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	ctx := withVariables(context.Background(), map[string]string{
+		"page.title": "Home",
+		"site.name":  "<Wiki>",
+	})
+	tests := []struct {
+		in, want string
+	}{
+		{"{{page.title}}", "Home"},
+		{"{{ page.title }}", "Home"},
+		{"{{site.name}}", "&lt;Wiki&gt;"},
+		{"{{page.unknown}}", "{{page.unknown}}"},
+		{`\{{page.title}}`, "{{page.title}}"},
+		{"{{Page.Title}}", "{{Page.Title}}"},
+	}
+	for _, tt := range tests {
+		if got := string(expandVariables(ctx, []byte(tt.in))); got != tt.want {
+			t.Errorf("expandVariables(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const maxSuggestions = 5
+
+// dictionary holds known words in lower case, bucketed by length in runes
+// so suggestions only compare words of similar length.
+type dictionary struct {
+	words    map[string]bool
+	byLength map[int][]string
+}
+
+// loadDictionaries reads word lists with one word per line, such as
+// /usr/share/dict/words. It returns nil when no files are given.
+func loadDictionaries(paths []string) (*dictionary, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	d := &dictionary{words: map[string]bool{}, byLength: map[int][]string{}}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			word := strings.ToLower(canonical(strings.TrimSpace(sc.Text())))
+			if word == "" || d.words[word] {
+				continue
+			}
+			d.words[word] = true
+			n := len([]rune(word))
+			d.byLength[n] = append(d.byLength[n], word)
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (d *dictionary) suggest(word string) []string {
+	w := []rune(word)
+	type candidate struct {
+		word string
+		dist int
+	}
+	var found []candidate
+	for n := len(w) - 2; n <= len(w)+2; n++ {
+		for _, c := range d.byLength[n] {
+			if dist := levenshtein(w, []rune(c)); dist <= 2 {
+				found = append(found, candidate{c, dist})
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].dist != found[j].dist {
+			return found[i].dist < found[j].dist
+		}
+		return found[i].word < found[j].word
+	})
+	suggestions := []string{}
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, found[i].word)
+	}
+	return suggestions
+}
+
+// titleWords are the words page titles are made of, so MeetingNotes makes
+// "meeting" and "notes" known as well as "meetingnotes".
+func titleWords(titles []string) map[string]bool {
+	words := map[string]bool{}
+	for _, title := range titles {
+		words[strings.ToLower(title)] = true
+		start := 0
+		runes := []rune(title)
+		for i := 1; i <= len(runes); i++ {
+			if i == len(runes) || (unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1])) {
+				words[strings.ToLower(string(runes[start:i]))] = true
+				start = i
+			}
+		}
+	}
+	return words
+}
+
+type spellingIssue struct {
+	// Start and End count UTF-16 code units, as JavaScript strings do, so
+	// an editor can use them as text positions directly.
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+	Word        string   `json:"word"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// checkSpelling returns the unknown words in text. Front matter, fenced
+// blocks, wiki links and link URLs are not checked, nor are words with
+// digits or single letters.
+func (d *dictionary) checkSpelling(text string, known map[string]bool) []spellingIssue {
+	skip := make([]bool, len(text))
+	mark := func(start, end int) {
+		for i := start; i < end; i++ {
+			skip[i] = true
+		}
+	}
+	_, content, err := parseFrontMatter([]byte(text))
+	if err == nil {
+		mark(0, len(text)-len(content))
+	}
+	// Skip fenced blocks line by line, the same way splitBlocks finds them.
+	inFence := false
+	for pos := len(text) - len(content); pos < len(text); {
+		end := strings.IndexByte(text[pos:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += pos + 1
+		}
+		line := strings.TrimSpace(text[pos:end])
+		switch {
+		case inFence:
+			mark(pos, end)
+			inFence = line != fence
+		case strings.HasPrefix(line, fence):
+			mark(pos, end)
+			header := strings.TrimPrefix(line, fence)
+			inFence = !(len(header) > len(fence) && strings.HasSuffix(header, fence))
+		}
+		pos = end
+	}
+	for _, m := range wikiLink.FindAllStringIndex(text, -1) {
+		mark(m[0], m[1])
+	}
+	for _, m := range externalLink.FindAllStringSubmatchIndex(text, -1) {
+		mark(m[2], m[3])
+	}
+
+	var issues []spellingIssue
+	units := 0
+	wordStart, wordUnits := -1, 0
+	flush := func(end int) {
+		if wordStart < 0 {
+			return
+		}
+		word := strings.Trim(text[wordStart:end], "'’")
+		start := wordStart
+		wordStart = -1
+		if len([]rune(word)) < 2 || strings.IndexFunc(word, unicode.IsDigit) >= 0 || skip[start] {
+			return
+		}
+		lower := strings.ToLower(canonical(word))
+		if d.words[lower] || known[lower] {
+			return
+		}
+		issues = append(issues, spellingIssue{
+			Start:       wordUnits,
+			End:         wordUnits + len(utf16.Encode([]rune(text[start:end]))),
+			Word:        word,
+			Suggestions: d.suggest(lower),
+		})
+	}
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) ||
+			(wordStart >= 0 && (unicode.IsMark(r) || r == '\'' || r == '’'))
+		if inWord && wordStart < 0 {
+			wordStart, wordUnits = i, units
+		}
+		if !inWord {
+			flush(i)
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	flush(len(text))
+	return issues
+}
+
+func (s *Server) apiSpellcheckHandler(w http.ResponseWriter, r *http.Request) {
+	if s.dictionary == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no dictionaries are configured"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "POST the text to check"})
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	titles, err := s.store.List(ctx)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	issues := s.dictionary.checkSpelling(string(data), titleWords(titles))
+	if issues == nil {
+		issues = []spellingIssue{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"issues": issues})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errPageNotFound = errors.New("page not found")
+
+type PageStore interface {
+	Load(ctx context.Context, title string) (*Page, error)
+	Save(ctx context.Context, p *Page) error
+	List(ctx context.Context) ([]string, error)
+}
+
+type fileStore struct {
+	dir   string
+	fsync bool
+}
+
+func newFileStore(dir string, fsync bool) *fileStore {
+	return &fileStore{dir: dir, fsync: fsync}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it into place, so readers see either the old or the new contents
+// and never a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, fsync bool) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if fsync {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *fileStore) path(title string) string {
+	return filepath.Join(s.dir, title+".txt")
+}
+
+// strayPath finds the file of a title whose name on disk is not in NFC,
+// as files created on macOS or copied with rsync may be. List reports
+// those under their canonical title, so Load and Save must find them.
+func (s *fileStore) strayPath(title string) (string, bool) {
+	if !hasNonASCII(title) {
+		return "", false
+	}
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return "", false
+	}
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".txt")
+		if ok && name != title && canonical(name) == title {
+			return filepath.Join(s.dir, file.Name()), true
+		}
+	}
+	return "", false
+}
+
+func hasNonASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fileStore) Load(ctx context.Context, title string) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path(title))
+	if errors.Is(err, fs.ErrNotExist) {
+		if stray, ok := s.strayPath(title); ok {
+			f, err = os.Open(stray)
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errPageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Page{Title: title, Body: body, ModTime: info.ModTime()}, nil
+}
+
+func (s *fileStore) Save(ctx context.Context, p *Page) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path := s.path(p.Title)
+	if err := writeFileAtomic(path, p.Body, 0600, s.fsync); err != nil {
+		return err
+	}
+	// Saving moves a page with a non-NFC file name to its canonical name.
+	// On file systems that ignore normalization both names are the same
+	// file, which must not be removed.
+	if stray, ok := s.strayPath(p.Title); ok {
+		saved, err1 := os.Stat(path)
+		old, err2 := os.Stat(stray)
+		if err1 == nil && err2 == nil && !os.SameFile(saved, old) {
+			return os.Remove(stray)
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var titles []string
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".txt" {
+			titles = append(titles, canonical(strings.TrimSuffix(file.Name(), ".txt")))
+		}
+	}
+	return titles, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+var tableAlign = map[string]string{
+	"l": "left", "left": "left",
+	"c": "center", "center": "center",
+	"r": "right", "right": "right",
+}
+
+// tableBlock renders ```csv and ```tsv blocks. Options after the language
+// are "noheader" to treat the first row as data, and align=l,c,r to set
+// per-column alignment.
+func tableBlock(comma rune) BlockRenderer {
+	return func(ctx context.Context, args string, content []byte) (template.HTML, error) {
+		header := true
+		var aligns []string
+		for _, opt := range strings.Fields(args) {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "header":
+				header = true
+			case "noheader":
+				header = false
+			case "align":
+				for _, a := range strings.Split(value, ",") {
+					align, ok := tableAlign[a]
+					if !ok && a != "" {
+						return "", fmt.Errorf("unknown alignment %q", a)
+					}
+					aligns = append(aligns, align)
+				}
+			default:
+				return "", fmt.Errorf("unknown option %q", opt)
+			}
+		}
+
+		r := csv.NewReader(bytes.NewReader(content))
+		r.Comma = comma
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return "", err
+		}
+
+		var b strings.Builder
+		b.WriteString(`<table class="data">`)
+		for i, row := range rows {
+			cell := "td"
+			if header && i == 0 {
+				cell = "th"
+			}
+			b.WriteString("<tr>")
+			for j, field := range row {
+				b.WriteString("<" + cell)
+				if j < len(aligns) && aligns[j] != "" {
+					b.WriteString(` style="text-align: ` + aligns[j] + `"`)
+				}
+				b.WriteString(">" + template.HTMLEscapeString(field) + "</" + cell + ">")
+			}
+			b.WriteString("</tr>")
+		}
+		b.WriteString("</table>")
+		return template.HTML(b.String()), nil
+	}
+}
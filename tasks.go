@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type Task struct {
+	Page string `json:"page"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+var taskItem = regexp.MustCompile(`^\s*[-*] \[([ xX])\] (.+)$`)
+
+// parseTasks finds "- [ ]" and "- [x]" items in a page body, skipping
+// fenced blocks. Line numbers are 1-based and count the whole body,
+// front matter included, so they match what the editor shows.
+func parseTasks(title string, body []byte) []Task {
+	var tasks []Task
+	for _, seg := range splitBlocks(body) {
+		if seg.fenced {
+			continue
+		}
+		for i, line := range strings.Split(string(seg.content), "\n") {
+			m := taskItem.FindStringSubmatch(strings.TrimSuffix(line, "\r"))
+			if m == nil {
+				continue
+			}
+			tasks = append(tasks, Task{Page: title, Line: seg.line + i, Text: m[2], Done: m[1] != " "})
+		}
+	}
+	return tasks
+}
+
+func (s *Server) openTasks(ctx context.Context) ([]Task, error) {
+	pages, err := s.loadAllPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []Task{}
+	for _, p := range withoutArchived(withoutPrivate(pages)) {
+		for _, t := range parseTasks(p.Title, p.Body) {
+			if !t.Done {
+				tasks = append(tasks, t)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+func (s *Server) tasksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	tasks, err := s.openTasks(ctx)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderTemplate(w, "tasks", tasks)
+}
+
+func (s *Server) apiTasksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	tasks, err := s.openTasks(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
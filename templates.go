@@ -0,0 +1,82 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//go:embed tmpl/*.html
+var builtinTemplates embed.FS
+
+// parseTemplates takes each template from dir when the file is there and
+// from the copy built into the binary otherwise, so an instance can
+// override view.html alone and still pick up changes to the rest.
+func parseTemplates(dir string, funcs template.FuncMap) (*template.Template, error) {
+	t := template.New("").Funcs(funcs)
+	for _, name := range templateFiles {
+		src, err := fs.ReadFile(builtinTemplates, "tmpl/"+name)
+		if dir != "" {
+			custom, cerr := os.ReadFile(filepath.Join(dir, name))
+			if cerr == nil {
+				src, err = custom, nil
+			} else if !errors.Is(cerr, fs.ErrNotExist) {
+				return nil, cerr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(name).Parse(string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+// templateFuncs are available to every template, built-in or overridden.
+func (s *Server) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"setting": s.settings.Get,
+		"date":    formatDate,
+		"excerpt": func(p *Page, max int) string { return excerpt(s.redact(p.Body), max) },
+		"pageURL": func(title string) string { return "/view/" + url.PathEscape(title) },
+		"editURL": func(title string) string { return "/edit/" + url.PathEscape(title) },
+		"pageLink": func(title string) template.HTML {
+			if !validTitle.MatchString(title) {
+				return template.HTML(template.HTMLEscapeString(title))
+			}
+			return template.HTML(wikiLinkToHTML([]byte("[[" + title + "]]")))
+		},
+	}
+}
+
+// formatDate formats t with a Go layout; the zero time, such as the
+// ModTime of a page not saved yet, gives an empty string.
+func formatDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// AddTemplateFuncs makes funcs available to templates, replacing built-in
+// functions of the same name, and parses the templates again so they can
+// use them. Like AddSaveValidator, it must be called before serving.
+func (s *Server) AddTemplateFuncs(funcs template.FuncMap) error {
+	for name, fn := range funcs {
+		s.funcs[name] = fn
+	}
+	t, err := parseTemplates(s.config.TemplateDir, s.funcs)
+	if err != nil {
+		return err
+	}
+	s.templates = t
+	return nil
+}
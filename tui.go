@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type tui struct {
+	server  *Server
+	store   PageStore
+	in      *bufio.Scanner
+	out     io.Writer
+	current string
+	// choices holds the titles the last listing or page view numbered, so
+	// the user can type a number instead of a title.
+	choices []string
+}
+
+func tuiCommand(args []string) error {
+	var config Config
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	storageFlags(fs, &config)
+	fs.Parse(args)
+
+	s, err := openServer(config)
+	if err != nil {
+		return err
+	}
+	t := &tui{server: s, store: s.store, in: bufio.NewScanner(os.Stdin), out: os.Stdout}
+	return t.run()
+}
+
+func (t *tui) run() error {
+	if err := t.list(); err != nil {
+		return err
+	}
+	for {
+		fmt.Fprint(t.out, "> ")
+		if !t.in.Scan() {
+			fmt.Fprintln(t.out)
+			return t.in.Err()
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(t.in.Text()), " ")
+		var err error
+		switch cmd {
+		case "":
+			continue
+		case "q", "quit":
+			return nil
+		case "?", "help":
+			t.help()
+		case "l", "ls":
+			err = t.list()
+		case "e", "edit":
+			err = t.edit(t.resolve(arg))
+		case "v", "view":
+			err = t.view(t.resolve(arg))
+		default:
+			err = t.view(t.resolve(strings.TrimSpace(cmd + " " + arg)))
+		}
+		if err != nil {
+			fmt.Fprintln(t.out, "error:", err)
+		}
+	}
+}
+
+func (t *tui) help() {
+	fmt.Fprintln(t.out, `commands:
+  ls             list all pages
+  Title or N     view a page by title or by its number
+  v [Title|N]    view a page (the current page by default)
+  e [Title|N]    edit a page in $EDITOR (the current page by default)
+  q              quit`)
+}
+
+func (t *tui) resolve(arg string) string {
+	arg = canonical(strings.TrimSpace(arg))
+	if arg == "" {
+		return t.current
+	}
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(t.choices) {
+		return t.choices[n-1]
+	}
+	return arg
+}
+
+func (t *tui) list() error {
+	titles, err := t.store.List(context.Background())
+	if err != nil {
+		return err
+	}
+	t.choices = titles
+	for i, title := range titles {
+		fmt.Fprintf(t.out, "%3d  %s\n", i+1, title)
+	}
+	return nil
+}
+
+func (t *tui) view(title string) error {
+	if !validTitle.MatchString(title) {
+		return fmt.Errorf("invalid page title %q", title)
+	}
+	p, err := t.store.Load(context.Background(), title)
+	if errors.Is(err, errPageNotFound) {
+		fmt.Fprintf(t.out, "%s does not exist yet; type \"e %s\" to create it\n", title, title)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t.current = title
+	fmt.Fprintf(t.out, "\n= %s =\n\n%s\n", title, bytes.TrimRight(p.Body, "\n"))
+
+	t.choices = nil
+	for _, m := range wikiLink.FindAllSubmatch(p.Body, -1) {
+		t.choices = append(t.choices, canonical(string(m[1])))
+	}
+	if len(t.choices) > 0 {
+		fmt.Fprintln(t.out, "\nlinks:")
+		for i, link := range t.choices {
+			fmt.Fprintf(t.out, "%3d  %s\n", i+1, link)
+		}
+	}
+	fmt.Fprintln(t.out)
+	return nil
+}
+
+func (t *tui) edit(title string) error {
+	if !validTitle.MatchString(title) {
+		return fmt.Errorf("invalid page title %q", title)
+	}
+	ctx := context.Background()
+	var body []byte
+	p, err := t.store.Load(ctx, title)
+	if err == nil {
+		body = p.Body
+	} else if !errors.Is(err, errPageNotFound) {
+		return err
+	}
+
+	f, err := os.CreateTemp("", title+".*.txt")
+	if err != nil {
+		return err
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if p != nil && bytes.Equal(edited, body) {
+		fmt.Fprintln(t.out, "no changes")
+		return nil
+	}
+	if err := t.server.savePage(ctx, &Page{Title: title, Body: norm.NFC.Bytes(edited)}); err != nil {
+		keep = true
+		return fmt.Errorf("%v; the edited text is in %s", err, f.Name())
+	}
+	fmt.Fprintln(t.out, "saved "+title)
+	return t.view(title)
+}
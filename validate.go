@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type SaveValidator func(ctx context.Context, p *Page) error
+
+var errPageTooLarge = errors.New("page is too large")
+var errEditConflict = errors.New("this page was changed by someone else while you were editing; review the current version before saving again")
+
+// editForm is what the edit template renders: the page being edited, the
+// version of the stored page it started from, and why the last save was
+// refused, if it was.
+type editForm struct {
+	*Page
+	Base  string
+	Error string
+	// Similar lists existing pages that look like the same topic when a
+	// new page is being created.
+	Similar []string
+}
+
+// bodyVersion identifies the stored contents an edit started from. A page
+// that does not exist yet has an empty version.
+func bodyVersion(p *Page) string {
+	if p == nil || p.Body == nil {
+		return ""
+	}
+	sum := sha256.Sum256(p.Body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkConflict compares the version the editor was opened on with what is
+// stored now. Forms without a base field skip the check.
+func (s *Server) checkConflict(ctx context.Context, r *http.Request, title string) error {
+	if _, ok := r.PostForm["base"]; !ok {
+		return nil
+	}
+	current, err := s.store.Load(ctx, title)
+	if errors.Is(err, errPageNotFound) {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+	if bodyVersion(current) != r.PostForm.Get("base") {
+		return errEditConflict
+	}
+	return nil
+}
+
+// editError re-renders the editor with the submitted text and a message,
+// instead of discarding the user's work on a failed save. Storage failures
+// are still reported as server errors.
+func (s *Server) editError(w http.ResponseWriter, r *http.Request, p *Page, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		storeError(w, err)
+		return
+	}
+	form := editForm{Page: p, Base: r.PostForm.Get("base"), Error: err.Error()}
+	status := http.StatusUnprocessableEntity
+	if errors.Is(err, errPageTooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, errEditConflict) {
+		status = http.StatusConflict
+		ctx, cancel := s.storeContext(r)
+		defer cancel()
+		current, loadErr := s.store.Load(ctx, p.Title)
+		if loadErr != nil && !errors.Is(loadErr, errPageNotFound) {
+			storeError(w, loadErr)
+			return
+		}
+		form.Base = bodyVersion(current)
+	}
+	w.WriteHeader(status)
+	s.renderTemplate(w, "edit", form)
+}
+
+func (s *Server) AddSaveValidator(v SaveValidator) {
+	s.validators = append(s.validators, v)
+}
+
+func (s *Server) validatePageSize(ctx context.Context, p *Page) error {
+	if max := s.config.MaxPageBytes; max > 0 && int64(len(p.Body)) > max {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", errPageTooLarge, len(p.Body), max)
+	}
+	return nil
+}
+
+func (s *Server) validateReservedTitle(ctx context.Context, p *Page) error {
+	patterns, err := compilePatterns(s.settings.Get("reserved_titles"))
+	if err != nil {
+		return err
+	}
+	for _, re := range patterns {
+		if re.MatchString(p.Title) {
+			return fmt.Errorf("%s is a reserved title", p.Title)
+		}
+	}
+	return nil
+}
+
+func (s *Server) validatePage(ctx context.Context, p *Page) error {
+	for _, v := range s.validators {
+		if err := v(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// savePage validates and saves p and announces the save, for writers
+// outside the HTTP handlers such as the command line and the TUI.
+func (s *Server) savePage(ctx context.Context, p *Page) error {
+	unlock := s.locks.Lock(p.Title)
+	defer unlock()
+	return s.savePageLocked(ctx, p)
+}
+
+// savePageLocked is savePage for callers that already hold p's lock.
+func (s *Server) savePageLocked(ctx context.Context, p *Page) error {
+	if err := s.validatePage(ctx, p); err != nil {
+		return err
+	}
+	if err := s.store.Save(ctx, p); err != nil {
+		return err
+	}
+	s.events.Publish(Event{Kind: EventPageSaved, Title: p.Title})
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"regexp"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// variablePattern matches {{name}} and {{scope.name}}. A backslash before
+// the braces keeps them as written.
+var variablePattern = regexp.MustCompile(`(\\?)\{\{\s*([a-z]+(?:\.[\p{L}\p{N}_-]+)?)\s*\}\}`)
+
+type variablesKey struct{}
+
+// withVariables sets the values {{name}} expands to while rendering with
+// ctx.
+func withVariables(ctx context.Context, vars map[string]string) context.Context {
+	return context.WithValue(ctx, variablesKey{}, vars)
+}
+
+// expandVariables replaces the variables in running text with their
+// HTML-escaped values. {{date}} is always today's date; unknown names are
+// left alone, so text that merely looks like a variable survives.
+func expandVariables(ctx context.Context, body []byte) []byte {
+	vars, _ := ctx.Value(variablesKey{}).(map[string]string)
+	return variablePattern.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := variablePattern.FindSubmatch(m)
+		if len(sub[1]) > 0 {
+			return m[1:]
+		}
+		name := string(sub[2])
+		value, ok := vars[name]
+		if name == "date" {
+			value, ok = time.Now().Format(dateLayout), true
+		}
+		if !ok {
+			return m
+		}
+		return []byte(template.HTMLEscapeString(value))
+	})
+}
+
+// pageVariables are the {{page.*}} and {{site.*}} values for p: its title,
+// modification date and scalar front matter fields, the site name and
+// URL, and whatever the site variables page defines.
+func (s *Server) pageVariables(ctx context.Context, p *Page, meta Metadata) map[string]string {
+	vars := map[string]string{}
+	for name, value := range s.siteVariables(ctx) {
+		vars["site."+name] = value
+	}
+	vars["site.name"] = s.settings.Get("site_name")
+	if s.config.BaseURL != "" {
+		vars["site.url"] = s.config.BaseURL
+	}
+	for name, value := range meta.Fields {
+		switch value.(type) {
+		case string, int, float64, bool:
+			vars["page."+name] = fmt.Sprint(value)
+		}
+	}
+	if p.Title != "" {
+		vars["page.title"] = p.Title
+	}
+	if !p.ModTime.IsZero() {
+		vars["page.modified"] = p.ModTime.Format(dateLayout)
+	}
+	return vars
+}
+
+// siteVariables reads the page named by the variables_page setting, a
+// YAML mapping of names to values.
+func (s *Server) siteVariables(ctx context.Context) map[string]string {
+	title := s.settings.Get("variables_page")
+	if title == "" {
+		return nil
+	}
+	p, err := s.store.Load(ctx, title)
+	if errors.Is(err, errPageNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("site variables: %v", err)
+		return nil
+	}
+	_, content, err := parseFrontMatter(p.Body)
+	if err != nil {
+		content = p.Body
+	}
+	var data map[string]any
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		log.Printf("site variables: %s: %v", title, err)
+		return nil
+	}
+	vars := make(map[string]string, len(data))
+	for name, value := range data {
+		switch value.(type) {
+		case string, int, float64, bool:
+			vars[name] = fmt.Sprint(value)
+		}
+	}
+	return vars
+}
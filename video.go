@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// videoFrameSources are the players the video shortcodes embed; the
+// default CSP allows them as frame-src.
+const videoFrameSources = "https://www.youtube-nocookie.com https://player.vimeo.com"
+
+var youtubeID = regexp.MustCompile(`^[A-Za-z0-9_-]{6,20}$`)
+var vimeoID = regexp.MustCompile(`^[0-9]{1,12}$`)
+
+// videoFrame is a lazily loaded player that keeps a 16:9 shape at any
+// width.
+func videoFrame(src, title string) template.HTML {
+	if title == "" {
+		title = "Video"
+	}
+	return template.HTML(`<iframe class="video" src="` + template.HTMLEscapeString(src) + `" title="` + template.HTMLEscapeString(title) +
+		`" style="width: 100%; max-width: 800px; aspect-ratio: 16 / 9; border: 0" loading="lazy" allowfullscreen` +
+		` allow="encrypted-media; picture-in-picture; fullscreen" referrerpolicy="strict-origin-when-cross-origin"></iframe>`)
+}
+
+// videoArg takes either a bare video ID or a link to the video, as copied
+// from the address bar.
+func videoArg(arg string, videoID func(*url.URL) string) string {
+	if u, ok := httpURL(arg); ok {
+		return videoID(u)
+	}
+	return arg
+}
+
+// youtubeShortcode embeds {{< youtube ID >}} through youtube-nocookie.com,
+// which sets no cookies until the video is played. start=SECONDS and
+// title="..." are optional.
+func youtubeShortcode(ctx context.Context, args []string, named map[string]string) (template.HTML, error) {
+	if len(args) != 1 {
+		return "", errors.New("want one video ID or URL")
+	}
+	id := videoArg(args[0], func(u *url.URL) string {
+		if strings.TrimPrefix(u.Hostname(), "www.") == "youtu.be" {
+			return strings.Trim(u.Path, "/")
+		}
+		if v := u.Query().Get("v"); v != "" {
+			return v
+		}
+		return strings.TrimPrefix(u.Path, "/embed/")
+	})
+	if !youtubeID.MatchString(id) {
+		return "", errors.New("not a YouTube video ID")
+	}
+	src := "https://www.youtube-nocookie.com/embed/" + id
+	if start := named["start"]; start != "" {
+		if n, err := strconv.Atoi(start); err != nil || n < 0 {
+			return "", errors.New("start must be a number of seconds")
+		}
+		src += "?start=" + start
+	}
+	return videoFrame(src, named["title"]), nil
+}
+
+// vimeoShortcode embeds {{< vimeo ID >}} with Vimeo's do-not-track flag,
+// which stops the player from tracking viewers.
+func vimeoShortcode(ctx context.Context, args []string, named map[string]string) (template.HTML, error) {
+	if len(args) != 1 {
+		return "", errors.New("want one video ID or URL")
+	}
+	id := videoArg(args[0], func(u *url.URL) string {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		return parts[len(parts)-1]
+	})
+	if !vimeoID.MatchString(id) {
+		return "", errors.New("not a Vimeo video ID")
+	}
+	return videoFrame("https://player.vimeo.com/video/"+id+"?dnt=1", named["title"]), nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type mention struct {
+	Source   string
+	Received string
+}
+
+// mentionStore keeps verified webmentions per page title, persisted as
+// JSON the same way settings are. An empty path keeps them in memory.
+type mentionStore struct {
+	mu      sync.RWMutex
+	path    string
+	byTitle map[string][]mention
+	// pending bounds how many incoming mentions are verified at once.
+	pending chan struct{}
+}
+
+func loadMentions(path string) (*mentionStore, error) {
+	m := &mentionStore{path: path, byTitle: map[string][]mention{}, pending: make(chan struct{}, 4)}
+	if path == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.byTitle); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *mentionStore) Get(title string) []mention {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.byTitle[title]
+}
+
+// Put records or, when present is false, removes the mention of title by
+// source. A source that stops linking re-sends to have itself removed.
+func (m *mentionStore) Put(title, source string, present bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []mention
+	for _, old := range m.byTitle[title] {
+		if old.Source != source {
+			list = append(list, old)
+		}
+	}
+	if present {
+		list = append(list, mention{Source: source, Received: time.Now().Format(dateLayout)})
+	}
+	if len(list) == 0 {
+		delete(m.byTitle, title)
+	} else {
+		m.byTitle[title] = list
+	}
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.byTitle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, data, 0600, true)
+}
+
+// publicClient fetches other sites on behalf of page content and mention
+// senders, so it refuses to connect to loopback, private and link-local
+// addresses.
+var publicClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+					return fmt.Errorf("refusing to connect to %s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+const maxFetchBytes = 1 << 20
+
+func httpURL(s string) (*url.URL, bool) {
+	u, err := url.Parse(s)
+	return u, err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// mentionTarget returns the page title a target URL points at, if it is a
+// view URL of this wiki.
+func (s *Server) mentionTarget(target string) (string, bool) {
+	prefix := strings.TrimSuffix(s.config.BaseURL, "/") + "/view/"
+	title, ok := strings.CutPrefix(target, prefix)
+	if !ok {
+		return "", false
+	}
+	title, err := url.PathUnescape(title)
+	if err != nil {
+		return "", false
+	}
+	title = canonical(title)
+	return title, validTitle.MatchString(title)
+}
+
+// webmentionHandler receives webmentions. Sources are fetched and checked
+// in the background, as the spec allows, and the sender gets 202.
+func (s *Server) webmentionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !parseForm(w, r) {
+		return
+	}
+	source, target := r.PostForm.Get("source"), r.PostForm.Get("target")
+	if _, ok := httpURL(source); !ok || source == target {
+		http.Error(w, "source must be another http(s) URL", http.StatusBadRequest)
+		return
+	}
+	title, ok := s.mentionTarget(target)
+	if !ok {
+		http.Error(w, "target is not a page of this wiki", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	if _, err := s.store.Load(ctx, title); errors.Is(err, errPageNotFound) {
+		http.Error(w, "target page does not exist", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	select {
+	case s.mentions.pending <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too many webmentions being verified, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	go func() {
+		defer func() { <-s.mentions.pending }()
+		present, err := linksTo(source, target)
+		if err != nil {
+			log.Printf("webmention from %s: %v", source, err)
+			return
+		}
+		if err := s.mentions.Put(title, source, present); err != nil {
+			log.Printf("webmention from %s: %v", source, err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// linksTo reports whether the document at source still mentions target. A
+// source that is gone counts as not linking.
+func linksTo(source, target string) (bool, error) {
+	resp, err := publicClient.Get(source)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("fetching source: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(body), target), nil
+}
+
+// externalTargets lists the distinct external URLs linked from a page body,
+// outside fenced blocks.
+func externalTargets(body []byte) []string {
+	_, content, _ := parseFrontMatter(body)
+	seen := map[string]bool{}
+	var targets []string
+	for _, seg := range splitBlocks(content) {
+		if seg.fenced {
+			continue
+		}
+		for _, m := range externalLink.FindAllSubmatch(seg.content, -1) {
+			if u := string(m[1]); !seen[u] {
+				seen[u] = true
+				targets = append(targets, u)
+			}
+		}
+	}
+	return targets
+}
+
+// sendWebmentions notifies every site a saved page links to that accepts
+// webmentions. It runs in the background after a save.
+func (s *Server) sendWebmentions(title string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	p, err := s.store.Load(ctx, title)
+	if err != nil {
+		log.Printf("%s: sending webmentions: %v", title, err)
+		return
+	}
+	// A mention announces the page's URL to every site it links to,
+	// which unlisted and noindex pages are meant to keep to themselves.
+	if meta, _, _ := parseFrontMatter(p.Body); meta.private() || meta.NoIndex {
+		return
+	}
+	source := strings.TrimSuffix(s.config.BaseURL, "/") + "/view/" + title
+	for _, target := range externalTargets(p.Body) {
+		if err := sendWebmention(ctx, source, target); err != nil {
+			log.Printf("%s: webmention to %s: %v", title, target, err)
+		}
+	}
+}
+
+func sendWebmention(ctx context.Context, source, target string) error {
+	endpoint, err := discoverEndpoint(ctx, target)
+	if err != nil || endpoint == "" {
+		return err
+	}
+	form := url.Values{"source": {source}, "target": {target}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := publicClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+var linkHeaderPart = regexp.MustCompile(`<([^>]*)>\s*;[^,]*\brel\s*=\s*"?([^",;]*)`)
+var htmlLinkTag = regexp.MustCompile(`(?is)<(?:link|a)\s[^>]*>`)
+var relAttr = regexp.MustCompile(`(?is)\brel\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+var hrefAttr = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+func attrValue(m []string) string {
+	return m[1] + m[2] + m[3]
+}
+
+func hasRel(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "webmention" {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverEndpoint finds target's webmention endpoint from its Link header
+// or the first <link> or <a> with rel="webmention". It returns "" when the
+// target does not accept webmentions.
+func discoverEndpoint(ctx context.Context, target string) (string, error) {
+	if _, ok := httpURL(target); !ok {
+		return "", nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := publicClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	found := ""
+	for _, h := range resp.Header.Values("Link") {
+		for _, m := range linkHeaderPart.FindAllStringSubmatch(h, -1) {
+			if found == "" && hasRel(m[2]) {
+				found = m[1]
+			}
+		}
+	}
+	if found == "" && strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+		if err != nil {
+			return "", err
+		}
+		for _, tag := range htmlLinkTag.FindAllString(string(body), -1) {
+			rel, href := relAttr.FindStringSubmatch(tag), hrefAttr.FindStringSubmatch(tag)
+			if rel != nil && href != nil && hasRel(attrValue(rel)) {
+				found = html.UnescapeString(attrValue(href))
+				break
+			}
+		}
+	}
+	if found == "" {
+		return "", nil
+	}
+	endpoint, err := resp.Request.URL.Parse(found)
+	if err != nil {
+		return "", err
+	}
+	return endpoint.String(), nil
+}
@@ -1,82 +1,219 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"html/template"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 type Page struct {
 	Title    string
 	Body     []byte
+	Meta     Metadata
+	ModTime  time.Time
 	HTMLBody template.HTML
+	Related  []relatedPage
+	Mentions []mention
+
+	Archived      bool
+	ArchivedSince string
+	ReviewDue     string
+	NoIndex       bool
+	// Lint holds the warnings shown right after a save.
+	Lint []LintWarning
 }
 
-var templates = template.Must(template.ParseFiles("tmpl/edit.html", "tmpl/view.html", "tmpl/wiki_link.html", "tmpl/all.html"))
-var validPath = regexp.MustCompile(`^/(edit|save|view)/([\p{L}\p{N}]+)$`)
-var wikiLink = regexp.MustCompile(`\[\[([\p{L}\p{N}]+)\]\]`)
-var externalLink = regexp.MustCompile(`\[(https?://[^\s]+)\s([^\]]+)\]`)
+type Config struct {
+	Addr            string
+	Store           string
+	DataDir         string
+	TemplateDir     string
+	StoreTimeout    time.Duration
+	Fsync           bool
+	MaxPageBytes    int64
+	MaxRequestBytes int64
+	// EncryptionKeyFile, if set, holds the key page bodies are encrypted
+	// with before they are stored.
+	EncryptionKeyFile string
 
-func (p *Page) save() error {
-	filename := "data/" + p.Title + ".txt"
-	return ioutil.WriteFile(filename, p.Body, 0600)
-}
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
 
-func htmlLink(href string, text string) []byte {
-	return []byte("<a href=\"" + href + "\">" + text + "</a>")
-}
+	ContentSecurityPolicy string
+	FrameAncestors        string
+	ReferrerPolicy        string
+	// CORSOrigins may call /api from their own pages; "*" allows any.
+	CORSOrigins []string
 
-func wikiLinkToHTML(link []byte) []byte {
-	matches := wikiLink.FindSubmatch(link)
-	if matches == nil {
-		return link
-	}
-	linkText := string(matches[1])
-	htmlLink := htmlLink("/view/"+linkText, linkText)
-	return []byte(template.HTML(htmlLink))
+	ExternalLinks LinkPolicy
+
+	// InboundEmailToken enables /api/email/TOKEN; InboundEmailAddress,
+	// if set, is the recipient messages must be addressed to.
+	InboundEmailToken   string
+	InboundEmailAddress string
+	// InboundHooksFile lists the /api/inbound/TOKEN webhooks.
+	InboundHooksFile string
+
+	// BaseURL is the public address of the wiki, e.g.
+	// https://wiki.example.com, used to build links to it for other sites.
+	BaseURL    string
+	Webmention bool
+
+	// RobotsFile replaces the generated robots.txt; NoIndex asks search
+	// engines to skip the whole wiki.
+	RobotsFile string
+	NoIndex    bool
+
+	// RedactSecrets masks likely credentials when pages are shown, using
+	// the built-in patterns plus those in SecretPatternsFile.
+	RedactSecrets      bool
+	SecretPatternsFile string
+
+	// CachePageSeconds and CacheBrowserSeconds are the s-maxage and
+	// max-age of read-only pages; see cacheControl.
+	CachePageSeconds    int
+	CacheBrowserSeconds int
+
+	// DictionaryFiles are the word lists /api/spellcheck checks against.
+	DictionaryFiles []string
+
+	// LintStrict refuses saves that have lint warnings instead of
+	// showing the warnings after the save.
+	LintStrict bool
+
+	// ShortcodesFile defines custom {{< name >}} shortcodes; see
+	// loadShortcodes.
+	ShortcodesFile string
+
+	// EmbedHosts are the sites whose URLs may be turned into oEmbed
+	// embeds; none by default, as embedding fetches them while rendering.
+	EmbedHosts []string
 }
 
-func externalLinkToHTML(link []byte) []byte {
-	matches := externalLink.FindSubmatch(link)
-	if matches == nil {
-		return link
-	}
-	linkHref := string(matches[1])
-	linkText := string(matches[2])
-	htmlLink := htmlLink(linkHref, linkText)
-	return []byte(template.HTML(htmlLink))
+type Server struct {
+	config     Config
+	store      PageStore
+	renderer   *Renderer
+	settings   *Settings
+	events     *EventBus
+	templates  *template.Template
+	funcs      template.FuncMap
+	validators []SaveValidator
+	linters    []LintCheck
+	recent     *recentPages
+	related    relatedIndex
+	reviews    reviewQueue
+	locks      *lockManager
+	inbound    map[string]*inboundHook
+	mentions   *mentionStore
+	secrets    []secretPattern
+	dictionary *dictionary
+	embeds     *embedder
 }
 
-func renderWikiLinks(body []byte) []byte {
-	body = wikiLink.ReplaceAllFunc(body, wikiLinkToHTML)
-	body = externalLink.ReplaceAllFunc(body, externalLinkToHTML)
-	return body
+var templateFiles = []string{"edit.html", "view.html", "wiki_link.html", "all.html", "settings.html", "journal.html", "tasks.html", "missing.html", "copy.html", "merge.html", "leave.html", "brokenlinks.html", "review.html", "secrets.html", "export.html", "import.html"}
+var validPath = regexp.MustCompile(`^/(edit|save|view|copy|stub)/([\p{L}\p{N}]+)$`)
+var validTitle = regexp.MustCompile(`^[\p{L}\p{N}]+$`)
+
+// canonical puts text in Unicode NFC. Titles reach the wiki from URLs,
+// forms, links and file names in whatever form the client's OS produced;
+// "café" typed on macOS is decomposed, and without this it would neither
+// match validTitle nor find the page saved from Linux.
+func canonical(s string) string {
+	return norm.NFC.String(s)
 }
 
-func wrapParagraphs(body template.HTML) template.HTML {
-	lines := strings.Split(string(body), "\n")
-	var paragraphs []string
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			paragraphs = append(paragraphs, "<p>"+line+"</p>")
+func NewServer(config Config, store PageStore) (*Server, error) {
+	settingsPath := filepath.Join(config.DataDir, "settings.json")
+	if config.Store == "memory" {
+		settingsPath = ""
+	}
+	settings, err := loadSettings(settingsPath)
+	if err != nil {
+		return nil, err
+	}
+	inbound, err := loadInboundHooks(config.InboundHooksFile)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := loadSecretPatterns(config.SecretPatternsFile)
+	if err != nil {
+		return nil, err
+	}
+	dict, err := loadDictionaries(config.DictionaryFiles)
+	if err != nil {
+		return nil, err
+	}
+	shortcodes, err := loadShortcodes(config.ShortcodesFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		config:     config,
+		store:      store,
+		renderer:   newRenderer(config.ExternalLinks),
+		settings:   settings,
+		events:     newEventBus(),
+		recent:     newRecentPages(),
+		locks:      newLockManager(),
+		inbound:    inbound,
+		secrets:    secrets,
+		dictionary: dict,
+	}
+	s.AddSaveValidator(s.validatePageSize)
+	s.AddSaveValidator(s.validateReservedTitle)
+	s.AddSaveValidator(validateFrontMatter)
+	s.AddSaveValidator(validateExpires)
+	s.AddSaveValidator(validateReview)
+	s.AddSaveValidator(s.validateDataPage)
+	s.AddSaveValidator(s.validateLint)
+	s.AddLintCheck(lintLines)
+	s.AddLintCheck(s.lintMissingLinks)
+	s.renderer.AddBlock("query", s.queryBlock)
+	s.events.Subscribe(EventPageSaved, func(Event) { s.related.invalidate() })
+	for name, sc := range shortcodes {
+		s.renderer.AddShortcode(name, sc)
+	}
+	if len(config.EmbedHosts) > 0 {
+		s.embeds = newEmbedder(config.EmbedHosts)
+		s.renderer.AddShortcode("embed", s.embeds.embedShortcode)
+		s.renderer.SetBareURLHandler(s.embeds.bareURL)
+	}
+	if config.Webmention {
+		if config.BaseURL == "" {
+			return nil, errors.New("webmentions need the wiki's public base URL")
+		}
+		mentionsPath := filepath.Join(config.DataDir, "webmentions.json")
+		if config.Store == "memory" {
+			mentionsPath = ""
 		}
+		if s.mentions, err = loadMentions(mentionsPath); err != nil {
+			return nil, err
+		}
+		s.events.Subscribe(EventPageSaved, func(e Event) { go s.sendWebmentions(e.Title) })
 	}
-	return template.HTML(strings.Join(paragraphs, "\n"))
-}
 
-func processBody(body []byte) template.HTML {
-	body = renderWikiLinks(body)
-	return wrapParagraphs(template.HTML(body))
+	s.funcs = s.templateFuncs()
+	s.templates, err = parseTemplates(config.TemplateDir, s.funcs)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 func getTitle(w http.ResponseWriter, r *http.Request) (string, error) {
-	m := validPath.FindStringSubmatch(r.URL.Path)
+	m := validPath.FindStringSubmatch(canonical(r.URL.Path))
 	if m == nil {
 		http.NotFound(w, r)
 		return "", errors.New("invalid Page Title")
@@ -84,83 +221,215 @@ func getTitle(w http.ResponseWriter, r *http.Request) (string, error) {
 	return m[2], nil // The title is the second subexpression.
 }
 
-func loadPage(title string) (*Page, error) {
-	filename := "data/" + title + ".txt"
-	body, err := ioutil.ReadFile(filename)
+// storeContext bounds a request's storage calls by the configured timeout,
+// so a stalled backend fails the request instead of holding it open.
+func (s *Server) storeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.config.StoreTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.config.StoreTimeout)
+}
+
+func storeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "Storage timed out", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// parseForm parses the request form, answering 413 when the body is over the
+// request size limit and 400 when it is malformed.
+func parseForm(w http.ResponseWriter, r *http.Request) bool {
+	err := r.ParseForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
 	if err != nil {
-		return nil, err
+		http.Error(w, "Cannot parse form", http.StatusBadRequest)
+		return false
 	}
-	return &Page{Title: title, Body: body}, nil
+	return true
 }
 
-func renderTemplate(w http.ResponseWriter, tmpl string, p *Page) {
-	err := templates.ExecuteTemplate(w, tmpl+".html", p)
+func (s *Server) renderTemplate(w http.ResponseWriter, tmpl string, data any) {
+	err := s.templates.ExecuteTemplate(w, tmpl+".html", data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-func viewHandler(w http.ResponseWriter, r *http.Request, title string) {
-	p, err := loadPage(title)
+func (s *Server) viewHandler(w http.ResponseWriter, r *http.Request, title string) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	p, err := s.store.Load(ctx, title)
+	if errors.Is(err, errPageNotFound) {
+		s.missingPage(ctx, w, r, title)
+		return
+	}
 	if err != nil {
-		http.Redirect(w, r, "/edit/"+title, http.StatusFound)
+		storeError(w, err)
 		return
 	}
-	p.HTMLBody = processBody(p.Body)
-	renderTemplate(w, "view", p)
+	s.recent.Add(visitorID(w, r), title)
+	meta, content, err := parseFrontMatter(p.Body)
+	if err != nil {
+		log.Printf("%s: %v", title, err)
+	}
+	p.Meta = meta
+	s.markArchived(p, time.Now())
+	if due, ok := reviewDue(p); ok && !time.Now().Before(due) {
+		p.ReviewDue = due.Format(dateLayout)
+	}
+	p.NoIndex = s.noIndex(p)
+	if meta.Redirect != "" && validTitle.MatchString(meta.Redirect) && r.URL.Query().Get("redirect") != "no" {
+		http.Redirect(w, r, "/view/"+meta.Redirect, http.StatusFound)
+		return
+	}
+	p.HTMLBody = s.renderContent(ctx, p, meta, content)
+	p.Related, err = s.relatedPages(ctx, title, relatedLimit)
+	if err != nil {
+		log.Printf("%s: related pages: %v", title, err)
+	}
+	if r.URL.Query().Get("lint") == "1" {
+		p.Lint, err = s.lintPage(ctx, p)
+		if err != nil {
+			log.Printf("%s: lint: %v", title, err)
+		}
+	}
+	if s.mentions != nil {
+		w.Header().Set("Link", `</webmention>; rel="webmention"`)
+		p.Mentions = s.mentions.Get(title)
+	}
+	s.renderTemplate(w, "view", p)
 }
 
-func editHandler(w http.ResponseWriter, r *http.Request, title string) {
-	p, err := loadPage(title)
+// renderContent renders the text of p the way /view/ shows it. The result
+// is sanitized here, so views, exports and previews all show the same HTML.
+func (s *Server) renderContent(ctx context.Context, p *Page, meta Metadata, content []byte) template.HTML {
+	ctx = withVariables(ctx, s.pageVariables(ctx, p, meta))
+	content = s.redact(content)
+	var html template.HTML
+	if meta.Type != "data" {
+		html = s.renderer.Render(ctx, content)
+	} else if out, err := s.renderDataPage(ctx, meta, content); err != nil {
+		html = template.HTML("<p>" + template.HTMLEscapeString(err.Error()) + "</p>")
+	} else {
+		html = out
+	}
+	return template.HTML(sanitizeHTML(string(html), s.frameHost))
+}
+
+// missingPage offers similarly named pages before sending the visitor to
+// the editor, so a mistyped link does not silently create a duplicate.
+func (s *Server) missingPage(ctx context.Context, w http.ResponseWriter, r *http.Request, title string) {
+	titles, err := s.listedTitles(ctx)
 	if err != nil {
-		p = &Page{Title: title}
+		storeError(w, err)
+		return
+	}
+	suggestions := fuzzyMatches(title, titles, 5)
+	if len(suggestions) == 0 {
+		http.Redirect(w, r, "/edit/"+title, http.StatusFound)
+		return
 	}
-	renderTemplate(w, "edit", p)
+	w.WriteHeader(http.StatusNotFound)
+	s.renderTemplate(w, "missing", struct {
+		Title       string
+		Suggestions []string
+	}{title, suggestions})
 }
 
-func saveHandler(w http.ResponseWriter, r *http.Request, title string) {
-	err := r.ParseForm()
+func (s *Server) editHandler(w http.ResponseWriter, r *http.Request, title string) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	p, err := s.store.Load(ctx, title)
+	form := editForm{Page: p}
+	if errors.Is(err, errPageNotFound) {
+		form.Page = &Page{Title: title}
+		titles, err := s.listedTitles(ctx)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		form.Similar = nearDuplicates(title, titles)
+	} else if err != nil {
+		storeError(w, err)
+		return
+	}
+	form.Base = bodyVersion(form.Page)
+	s.renderTemplate(w, "edit", form)
+}
+
+func (s *Server) saveHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if !parseForm(w, r) {
+		return
+	}
+	body, err := s.submittedBody(r)
 	if err != nil {
-		http.Error(w, "Cannot parse form", http.StatusInternalServerError)
+		http.Error(w, "Cannot convert the submitted HTML", http.StatusBadRequest)
 		return
 	}
-	body := r.FormValue("body")
 	p := &Page{Title: title, Body: []byte(body)}
-	err = p.save()
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	unlock := s.locks.Lock(title)
+	defer unlock()
+	err = s.checkConflict(ctx, r, title)
+	if err == nil {
+		err = s.validatePage(ctx, p)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.editError(w, r, p, err)
 		return
 	}
-	http.Redirect(w, r, "/view/"+title, http.StatusFound)
+	err = s.store.Save(ctx, p)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.events.Publish(Event{Kind: EventPageSaved, Title: title})
+	target := "/view/" + title
+	if warnings, err := s.lintPage(ctx, p); err == nil && len(warnings) > 0 {
+		target += "?lint=1"
+	}
+	http.Redirect(w, r, target, http.StatusFound)
 }
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/view/FrontPage", http.StatusFound)
+func (s *Server) homeHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/view/"+s.settings.Get("default_page"), http.StatusFound)
 }
 
-func allHandler(w http.ResponseWriter, r *http.Request) {
-	files, err := ioutil.ReadDir("data")
+func (s *Server) allHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.storeContext(r)
+	defer cancel()
+	pages, err := s.loadAllPages(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-
-	var titles []string
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".txt" {
-			title := strings.TrimSuffix(file.Name(), ".txt")
-			titles = append(titles, title)
+	data := struct {
+		Titles       []string
+		ShowArchived bool
+		Archived     int
+	}{ShowArchived: r.URL.Query().Get("archived") == "1"}
+	for _, p := range withoutPrivate(pages) {
+		if p.Archived {
+			data.Archived++
+			if !data.ShowArchived {
+				continue
+			}
 		}
+		data.Titles = append(data.Titles, p.Title)
 	}
-	err = templates.ExecuteTemplate(w, "all.html", titles)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	s.renderTemplate(w, "all", data)
 }
 
 func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		m := validPath.FindStringSubmatch(r.URL.Path)
+		m := validPath.FindStringSubmatch(canonical(r.URL.Path))
 		if m == nil {
 			http.NotFound(w, r)
 			return
@@ -169,12 +438,66 @@ func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.Handl
 	}
 }
 
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/view/", makeHandler(s.viewHandler))
+	mux.HandleFunc("/edit/", makeHandler(s.editHandler))
+	mux.HandleFunc("/save/", makeHandler(s.saveHandler))
+	mux.HandleFunc("/copy/", makeHandler(s.copyHandler))
+	mux.HandleFunc("/stub/", makeHandler(s.stubHandler))
+	mux.HandleFunc("/all", s.allHandler)
+	mux.HandleFunc("/today", s.todayHandler)
+	mux.HandleFunc("/journal", s.journalHandler)
+	mux.HandleFunc("/leave", s.leaveHandler)
+	mux.HandleFunc("/tasks", s.tasksHandler)
+	mux.HandleFunc("/go", s.goHandler)
+	mux.HandleFunc("/export", s.exportHandler)
+	mux.HandleFunc("/export.zip", s.exportZipHandler)
+	mux.HandleFunc("/export/", s.markdownHandler)
+	mux.HandleFunc("/opensearch.xml", s.openSearchHandler)
+	mux.HandleFunc("/robots.txt", s.robotsHandler)
+	for _, route := range s.apiRoutes() {
+		mux.HandleFunc(route.pattern(), route.handler)
+	}
+	mux.HandleFunc("/admin/settings", s.settingsHandler)
+	mux.HandleFunc("/admin/merge", s.mergeHandler)
+	mux.HandleFunc("/admin/brokenlinks", s.brokenLinksHandler)
+	mux.HandleFunc("/admin/review", s.reviewHandler)
+	mux.HandleFunc("/admin/secrets", s.secretsHandler)
+	mux.HandleFunc("/admin/import", s.importHandler)
+	if s.mentions != nil {
+		mux.HandleFunc("/webmention", s.webmentionHandler)
+	}
+	mux.HandleFunc("/", s.homeHandler)
+	return s.limitRequestBody(s.securityHeaders(s.cors(s.checkOrigin(s.cacheHeaders(mux)))))
+}
+
+// HTTPServer returns an http.Server for the wiki with the configured
+// timeouts, so slow clients cannot hold connections open indefinitely.
+func (s *Server) HTTPServer() *http.Server {
+	return &http.Server{
+		Addr:              s.config.Addr,
+		Handler:           s.Handler(),
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+}
+
+func (s *Server) limitRequestBody(next http.Handler) http.Handler {
+	if s.config.MaxRequestBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
 func main() {
-	http.HandleFunc("/view/", makeHandler(viewHandler))
-	http.HandleFunc("/edit/", makeHandler(editHandler))
-	http.HandleFunc("/save/", makeHandler(saveHandler))
-	http.HandleFunc("/all", allHandler)
-	http.HandleFunc("/", homeHandler)
-	fmt.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 }